@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ObjectStore is the subset of an S3-compatible API used for deployment.
+type ObjectStore interface {
+	List(prefix string) ([]S3Object, error)
+	PutFile(key, file, contentType, cacheControl string) error
+	Delete(key string) error
+
+	// ContentETag returns the ETag a file would get when uploaded with PutFile.
+	ContentETag(file string) (string, error)
+}
+
+// DeployProjector syncs the output directory to an object store bucket:
+// new and changed files are uploaded, unchanged ones (same size and ETag) are skipped,
+// and, optionally, objects without a local file are deleted.
+type DeployProjector struct {
+	outputDir string
+	store     ObjectStore
+	prefix    string // key prefix, e.g. "site/"
+	delete    bool
+	dryRun    bool
+	workers   int
+}
+
+type deployAction struct {
+	key  string
+	path string // local file to upload, empty for deletions
+}
+
+func (p DeployProjector) Name() string {
+	return "deploy"
+}
+
+func (p DeployProjector) Run(_ *BuildGraph) error {
+	local, err := p.localFiles()
+	if err != nil {
+		return err
+	}
+
+	objects, err := p.store.List(p.prefix)
+	if err != nil {
+		return fmt.Errorf("listing bucket: %w", err)
+	}
+	remote := make(map[string]S3Object, len(objects))
+	for _, object := range objects {
+		remote[object.Key] = object
+	}
+
+	var (
+		uploads   []deployAction
+		deletes   []deployAction
+		unchanged int
+	)
+	for _, key := range sortedKeys(local) {
+		object, ok := remote[key]
+		if ok {
+			same, err := p.sameContent(local[key], object)
+			if err != nil {
+				return err
+			}
+			if same {
+				unchanged++
+				continue
+			}
+		}
+		uploads = append(uploads, deployAction{key: key, path: local[key]})
+	}
+	if p.delete {
+		for _, key := range sortedKeys(remote) {
+			if _, ok := local[key]; !ok {
+				deletes = append(deletes, deployAction{key: key})
+			}
+		}
+	}
+
+	if p.dryRun {
+		for _, action := range uploads {
+			log.Printf("Would upload %s", action.key)
+		}
+		for _, action := range deletes {
+			log.Printf("Would delete %s", action.key)
+		}
+		log.Printf("Deploy (dry run): %d to upload, %d unchanged, %d to delete", len(uploads), unchanged, len(deletes))
+		return nil
+	}
+
+	// uploads go first, so pages never link to deleted objects
+	if err := p.apply(uploads); err != nil {
+		return err
+	}
+	if err := p.apply(deletes); err != nil {
+		return err
+	}
+
+	log.Printf("Deploy: %d uploaded, %d unchanged, %d deleted", len(uploads), unchanged, len(deletes))
+	return nil
+}
+
+// localFiles maps object keys to files in the output directory.
+func (p DeployProjector) localFiles() (map[string]string, error) {
+	files := map[string]string{}
+	err := filepath.WalkDir(p.outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.outputDir, path)
+		if err != nil {
+			return err
+		}
+		files[p.prefix+filepath.ToSlash(rel)] = path
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking output directory %q: %w", p.outputDir, err)
+	}
+	return files, nil
+}
+
+// apply runs actions with a pool of workers and returns all errors.
+func (p DeployProjector) apply(actions []deployAction) error {
+	if len(actions) == 0 {
+		return nil
+	}
+
+	jobs := make(chan deployAction)
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		failed []error
+	)
+
+	for i := 0; i < max(p.workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for action := range jobs {
+				if err := p.applyOne(action); err != nil {
+					mu.Lock()
+					failed = append(failed, err)
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+
+	for _, action := range actions {
+		jobs <- action
+	}
+	close(jobs)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Slice(failed, func(i, j int) bool { return failed[i].Error() < failed[j].Error() })
+		return fmt.Errorf("%d of %d object%s failed: %w", len(failed), len(actions), plural(len(actions)), errors.Join(failed...))
+	}
+	return nil
+}
+
+func (p DeployProjector) applyOne(action deployAction) error {
+	if action.path == "" {
+		return p.store.Delete(action.key)
+	}
+	return p.store.PutFile(action.key, action.path, contentType(action.key), cacheControl(action.key))
+}
+
+// sameContent reports whether an object has the same content as a local file.
+func (p DeployProjector) sameContent(file string, object S3Object) (bool, error) {
+	info, err := os.Stat(file)
+	if err != nil {
+		return false, fmt.Errorf("checking %q: %w", file, err)
+	}
+	if info.Size() != object.Size {
+		return false, nil
+	}
+
+	etag, err := p.store.ContentETag(file)
+	if err != nil {
+		return false, err
+	}
+	return strings.EqualFold(etag, object.ETag), nil
+}
+
+// cacheControl returns the Cache-Control header for an object key.
+// Pages and data files change with every content update and must be revalidated,
+// other assets (styles, scripts, images) may be cached for a while.
+func cacheControl(key string) string {
+	switch strings.ToLower(path.Ext(key)) {
+	case ".html", ".json", ".xml", ".md", ".txt", "":
+		return "public, max-age=0, must-revalidate"
+	default:
+		return "public, max-age=3600"
+	}
+}
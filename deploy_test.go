@@ -0,0 +1,80 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDeployProjectorSyncsChangedFiles(t *testing.T) {
+	fake, server := newFakeS3(t, "site")
+	fake.put("site/index.html", "<h1>Home</h1>")
+	fake.put("site/Movies/Old.html", "old")
+	fake.put("site/style.css", "body{}")
+	fake.put("other/keep.txt", "not ours")
+	fake.failPuts["site/Movies/Heat Part 2.html"] = 1
+
+	outputDir := t.TempDir()
+	mustWriteFile(t, filepath.Join(outputDir, "index.html"), "<h1>Home</h1>")
+	mustWriteFile(t, filepath.Join(outputDir, "style.css"), "body{color:red}")
+	mustWriteFile(t, filepath.Join(outputDir, "Movies", "Heat Part 2.html"), "heat")
+
+	projector := DeployProjector{
+		outputDir: outputDir,
+		store: S3Client{
+			endpoint:        server.URL,
+			region:          "auto",
+			bucket:          "site",
+			accessKeyID:     "key-id",
+			accessKeySecret: "secret",
+			attempts:        2,
+			retryDelay:      time.Millisecond,
+		},
+		prefix:  "site/",
+		dryRun:  true,
+		delete:  true,
+		workers: 2,
+	}
+
+	if err := projector.Run(nil); err != nil {
+		t.Fatalf("Run() dry run error = %v", err)
+	}
+	if got := fake.mutating(); len(got) != 0 {
+		t.Fatalf("dry run changed the bucket: %v", got)
+	}
+
+	projector.dryRun = false
+	if err := projector.Run(nil); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	want := []string{
+		"DELETE site/Movies/Old.html",
+		"PUT site/Movies/Heat Part 2.html", // failed once, retried
+		"PUT site/Movies/Heat Part 2.html",
+		"PUT site/style.css",
+	}
+	if got := fake.mutating(); !reflect.DeepEqual(got, want) {
+		t.Fatalf("requests = %v, want %v", got, want)
+	}
+
+	heat := fake.objects["site/Movies/Heat Part 2.html"]
+	if heat.body != "heat" || heat.contentType != "text/html; charset=utf-8" || heat.cacheControl != "public, max-age=0, must-revalidate" {
+		t.Errorf("uploaded page = %#v", heat)
+	}
+	if style := fake.objects["site/style.css"]; style.contentType != "text/css; charset=utf-8" || style.cacheControl != "public, max-age=3600" {
+		t.Errorf("uploaded style = %#v", style)
+	}
+	if _, ok := fake.objects["other/keep.txt"]; !ok {
+		t.Errorf("object outside of the prefix was deleted")
+	}
+
+	// second run has nothing to do
+	if err := projector.Run(nil); err != nil {
+		t.Fatalf("Run() second time error = %v", err)
+	}
+	if got := fake.mutating(); len(got) != 0 {
+		t.Fatalf("second run requests = %v, want none", got)
+	}
+}
@@ -147,6 +147,12 @@ func escapeAnnotationMessage(s string) string {
 	return s
 }
 
+// builtinContentFields are content fields that are not in the schema,
+// but that Content always has (see codegen/templates/content.gogo).
+var builtinContentFields = map[string]string{
+	"aliases": "string",
+}
+
 type SchemaMetadata struct {
 	types map[string]map[string]string
 }
@@ -181,6 +187,14 @@ func LoadSchemaMetadata(infoDir string) (*SchemaMetadata, error) {
 		}
 	}
 
+	if content := meta.types["content"]; content != nil {
+		for name, fieldType := range builtinContentFields {
+			if _, ok := content[name]; !ok {
+				content[name] = fieldType
+			}
+		}
+	}
+
 	return meta, nil
 }
 
@@ -1,34 +1,262 @@
 package main
 
 import (
+	"bytes"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"log"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
+	"sync"
 )
 
-func copyFile(src, dst string) error {
-	log.Printf("Copying file %q to %q", src, dst)
-	dir := filepath.Dir(dst)
-	if err := os.MkdirAll(dir, 0o755); err != nil {
-		return err
+// outputWriter writes generated files only when their content differs
+// from what is already on disk, so unchanged files keep their modification time
+// and sync tools (rsync, R2 uploads) don't treat them as changed.
+// It also keeps track of all files produced during a run,
+// so files left from previous runs can be pruned.
+// It is safe for concurrent use.
+type outputWriter struct {
+	mu        sync.Mutex
+	written   int
+	unchanged int
+	removed   int
+	outputs   map[string][]string // output path -> source files
+}
+
+// OutputFile is a file produced by a projector.
+type OutputFile struct {
+	Path    string
+	Sources []string // files the output was generated from, if any
+}
+
+func newOutputWriter() *outputWriter {
+	return &outputWriter{outputs: map[string][]string{}}
+}
+
+// WriteFile writes data to path, creating parent directories as needed.
+// It returns true if the file was written, and false if it already had the same content.
+// Sources are the files the output was generated from.
+func (w *outputWriter) WriteFile(path string, data []byte, sources ...string) (bool, error) {
+	w.Claim(path, sources...)
+
+	same, err := sameContent(path, data)
+	if err != nil {
+		return false, err
+	}
+	if same {
+		w.count(&w.unchanged)
+		return false, nil
 	}
 
-	in, err := os.Open(src)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return false, fmt.Errorf("creating directory: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return false, fmt.Errorf("writing file: %w", err)
+	}
+
+	w.count(&w.written)
+	return true, nil
+}
+
+// CopyFile copies src to dst, unless dst already has the same content.
+// Sources are the files the output was copied from, relative to their input directory.
+// Files are streamed rather than read into memory, as static and media files can be large.
+func (w *outputWriter) CopyFile(src, dst string, sources ...string) error {
+	w.Claim(dst, sources...)
+
+	same, err := sameFile(src, dst)
+	if err != nil {
+		return fmt.Errorf("copying %q to %q: %w", src, dst, err)
+	}
+	if same {
+		w.count(&w.unchanged)
+		return nil
+	}
+
+	if err := copyFile(src, dst); err != nil {
+		return fmt.Errorf("copying %q to %q: %w", src, dst, err)
+	}
+	w.count(&w.written)
+	log.Printf("Copied file %q to %q", src, dst)
+
+	return nil
+}
+
+// Claim records a file as produced during the run without writing it,
+// e.g. when the file is known to be up to date.
+func (w *outputWriter) Claim(path string, sources ...string) {
+	path = filepath.Clean(path)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	existing := w.outputs[path]
+	for _, source := range sources {
+		if source != "" && !slices.Contains(existing, source) {
+			existing = append(existing, source)
+		}
+	}
+	sort.Strings(existing)
+	w.outputs[path] = existing
+}
+
+// Outputs returns all files written, kept unchanged or claimed, sorted by path.
+func (w *outputWriter) Outputs() []OutputFile {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	result := make([]OutputFile, 0, len(w.outputs))
+	for _, path := range sortedKeys(w.outputs) {
+		result = append(result, OutputFile{Path: path, Sources: w.outputs[path]})
+	}
+	return result
+}
+
+// Remove removes a previously generated file, if it exists.
+func (w *outputWriter) Remove(path string) error {
+	err := os.Remove(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("removing %q: %w", path, err)
+	}
+
+	w.mu.Lock()
+	w.removed++
+	delete(w.outputs, filepath.Clean(path))
+	w.mu.Unlock()
+	return nil
+}
+
+// Summary returns a human-readable summary of written, unchanged and removed files.
+func (w *outputWriter) Summary() string {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return fmt.Sprintf("%d written, %d unchanged, %d removed", w.written, w.unchanged, w.removed)
+}
+
+func (w *outputWriter) count(counter *int) {
+	w.mu.Lock()
+	*counter++
+	w.mu.Unlock()
+}
+
+// sameContent reports whether the file at path exists and contains exactly data.
+func sameContent(path string, data []byte) (bool, error) {
+	info, err := os.Stat(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("checking existing file: %w", err)
+	}
+	if !info.Mode().IsRegular() || info.Size() != int64(len(data)) {
+		return false, nil
+	}
+
+	existing, err := os.ReadFile(path)
 	if err != nil {
-		return err
+		return false, fmt.Errorf("reading existing file: %w", err)
 	}
-	defer func() { _ = in.Close() }()
 
-	out, err := os.Create(dst)
+	return bytes.Equal(existing, data), nil
+}
+
+// sameFile reports whether the file at dst exists and has the same content as src,
+// comparing sizes first and then the files chunk by chunk.
+func sameFile(src, dst string) (bool, error) {
+	srcInfo, err := os.Stat(src)
+	if err != nil {
+		return false, fmt.Errorf("reading source file: %w", err)
+	}
+	dstInfo, err := os.Stat(dst)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	}
 	if err != nil {
-		return err
+		return false, fmt.Errorf("checking existing file: %w", err)
+	}
+	if !dstInfo.Mode().IsRegular() || dstInfo.Size() != srcInfo.Size() {
+		return false, nil
 	}
-	defer func() { _ = out.Close() }()
 
+	a, err := os.Open(src)
+	if err != nil {
+		return false, fmt.Errorf("reading source file: %w", err)
+	}
+	defer a.Close()
+	b, err := os.Open(dst)
+	if err != nil {
+		return false, fmt.Errorf("reading existing file: %w", err)
+	}
+	defer b.Close()
+
+	bufA, bufB := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		n, errA := io.ReadFull(a, bufA)
+		m, errB := io.ReadFull(b, bufB)
+		if !bytes.Equal(bufA[:n], bufB[:m]) {
+			return false, nil
+		}
+		if errA == io.EOF || errA == io.ErrUnexpectedEOF {
+			// the sizes match, unless a file changed while reading
+			return errB == errA, nil
+		}
+		if errA != nil {
+			return false, fmt.Errorf("reading source file: %w", errA)
+		}
+		if errB != nil {
+			return false, nil
+		}
+	}
+}
+
+// copyFile streams src to dst, creating parent directories as needed.
+func copyFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return fmt.Errorf("reading source file: %w", err)
+	}
+	defer in.Close()
+
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o644)
+	if err != nil {
+		return fmt.Errorf("creating file: %w", err)
+	}
 	if _, err := io.Copy(out, in); err != nil {
-		return err
+		out.Close()
+		return fmt.Errorf("writing file: %w", err)
 	}
+	if err := out.Close(); err != nil {
+		return fmt.Errorf("writing file: %w", err)
+	}
+	return nil
+}
 
-	return out.Sync()
+// writeFileAtomic writes a file through a temporary one,
+// so that an interrupted build leaves either the old or the new content.
+func writeFileAtomic(path string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, b, 0o644); err != nil {
+		return fmt.Errorf("writing %q: %w", path, err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("replacing %q: %w", path, err)
+	}
+	return nil
 }
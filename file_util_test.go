@@ -0,0 +1,107 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOutputWriterSkipsUnchangedFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a", "index.html")
+	w := newOutputWriter()
+
+	if written, err := w.WriteFile(path, []byte("hello")); err != nil || !written {
+		t.Fatalf("WriteFile() = %v, %v, expected new file to be written", written, err)
+	}
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(path, past, past); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+
+	if written, err := w.WriteFile(path, []byte("hello")); err != nil || written {
+		t.Fatalf("WriteFile() = %v, %v, expected unchanged file to be skipped", written, err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Fatalf("unchanged file mtime = %v, want %v", info.ModTime(), past)
+	}
+
+	if written, err := w.WriteFile(path, []byte("hallo")); err != nil || !written {
+		t.Fatalf("WriteFile() = %v, %v, expected changed file to be written", written, err)
+	}
+	if got := mustReadFile(t, path); got != "hallo" {
+		t.Fatalf("file content = %q, want %q", got, "hallo")
+	}
+
+	copied := filepath.Join(dir, "b.html")
+	if err := w.CopyFile(path, copied); err != nil {
+		t.Fatalf("CopyFile() error = %v", err)
+	}
+	if err := w.CopyFile(path, copied); err != nil {
+		t.Fatalf("CopyFile() error = %v", err)
+	}
+
+	if err := w.Remove(copied); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if err := w.Remove(copied); err != nil {
+		t.Fatalf("Remove() of a missing file error = %v", err)
+	}
+
+	if got, want := w.Summary(), "3 written, 2 unchanged, 1 removed"; got != want {
+		t.Fatalf("Summary() = %q, want %q", got, want)
+	}
+}
+
+func TestOutputWriterCopyFileComparesContent(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "static", "sprite.png")
+	dst := filepath.Join(dir, "output", "sprite.png")
+	w := newOutputWriter()
+
+	// larger than a comparison chunk, differing only at the end
+	data := strings.Repeat("a", 100*1024)
+	mustWriteFile(t, src, data+"1")
+	if err := w.CopyFile(src, dst, "sprite.png"); err != nil {
+		t.Fatalf("CopyFile() error = %v", err)
+	}
+
+	past := time.Now().Add(-time.Hour).Truncate(time.Second)
+	if err := os.Chtimes(dst, past, past); err != nil {
+		t.Fatalf("Chtimes() error = %v", err)
+	}
+	if err := w.CopyFile(src, dst, "sprite.png"); err != nil {
+		t.Fatalf("CopyFile() error = %v", err)
+	}
+	info, err := os.Stat(dst)
+	if err != nil {
+		t.Fatalf("Stat() error = %v", err)
+	}
+	if !info.ModTime().Equal(past) {
+		t.Fatalf("unchanged copy mtime = %v, want %v", info.ModTime(), past)
+	}
+
+	// same size, different content
+	mustWriteFile(t, src, data+"2")
+	if err := w.CopyFile(src, dst, "sprite.png"); err != nil {
+		t.Fatalf("CopyFile() error = %v", err)
+	}
+	if got := mustReadFile(t, dst); got != data+"2" {
+		t.Fatalf("copied file ends with %q, want %q", got[len(got)-1:], "2")
+	}
+
+	if got, want := w.Summary(), "2 written, 1 unchanged, 0 removed"; got != want {
+		t.Fatalf("Summary() = %q, want %q", got, want)
+	}
+	if got, want := w.Outputs(), []OutputFile{{Path: dst, Sources: []string{"sprite.png"}}}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("Outputs() = %v, want %v", got, want)
+	}
+}
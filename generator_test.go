@@ -1,6 +1,8 @@
 package main
 
 import (
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/alsosee/finder/structs"
@@ -273,3 +275,21 @@ func TestAddAwardsCanonicalizesColonReferences(t *testing.T) {
 		t.Fatalf("got missing award content %#v, expected none", b.awardsMissingContent)
 	}
 }
+
+func TestProcessMarkdownFileDropsRawHTML(t *testing.T) {
+	infoDir := t.TempDir()
+	mustWriteFile(t, filepath.Join(infoDir, "About.md"), "# About\n\n<script>alert(1)</script>\n\nText with <img src=x onerror=alert(1)> inline HTML.\n\n- [x] done\n")
+
+	b := NewGraphBuilder(structs.Config{}, &ScanResult{}, nil, infoDir, false)
+	if err := b.processMarkdownFile("About.md"); err != nil {
+		t.Fatalf("processMarkdownFile() error = %v", err)
+	}
+
+	body := b.contents["About"].HTML
+	if strings.Contains(body, "<script") || strings.Contains(body, "<img") {
+		t.Fatalf("rendered Markdown contains raw HTML: %s", body)
+	}
+	if !strings.Contains(body, "<h1") || !strings.Contains(body, "inline HTML.") || !strings.Contains(body, `<input type="checkbox" disabled checked>`) {
+		t.Fatalf("rendered Markdown lost its content: %s", body)
+	}
+}
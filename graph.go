@@ -2,6 +2,8 @@ package main
 
 import (
 	"path/filepath"
+	"slices"
+	"sort"
 	"strings"
 
 	"github.com/alsosee/finder/structs"
@@ -96,3 +98,30 @@ func (g *BuildGraph) OpenGraphImage(id string) string {
 	}
 	return openGraphURL(g.Config.OpenGraphHost, id)
 }
+
+func (g *BuildGraph) OpenGraphIndexImage(dir string) string {
+	if !g.OpenGraphEnabled || g.Config.OpenGraphHost == "" {
+		return ""
+	}
+	return joinURL(g.Config.OpenGraphHost, openGraphIndexKey(dir))
+}
+
+// ReferencingSources returns sorted source files of pages referencing the given (missing) page.
+func (g *BuildGraph) ReferencingSources(id string) []string {
+	var sources []string
+	add := func(from string) {
+		if content, ok := g.Contents[from]; ok && !slices.Contains(sources, content.Source) {
+			sources = append(sources, content.Source)
+		}
+	}
+
+	for from := range g.Connections[id] {
+		add(from)
+	}
+	for _, award := range g.AwardsMissingContent[id] {
+		add(award.Reference)
+	}
+
+	sort.Strings(sources)
+	return sources
+}
@@ -11,6 +11,7 @@ import (
 	"strings"
 
 	"github.com/gomarkdown/markdown"
+	mdhtml "github.com/gomarkdown/markdown/html"
 
 	"github.com/alsosee/finder/structs"
 )
@@ -152,7 +153,9 @@ func (b *GraphBuilder) processMarkdownFile(file string) error {
 		return fmt.Errorf("reading file: %w", err)
 	}
 
-	htmlBody := markdown.ToHTML(contentBytes, nil, nil)
+	// raw HTML is dropped, as the rendered body is not escaped again by the templates
+	renderer := mdhtml.NewRenderer(mdhtml.RendererOptions{Flags: mdhtml.CommonFlags | mdhtml.SkipHTML})
+	htmlBody := markdown.ToHTML(contentBytes, nil, renderer)
 	htmlBody = bytes.ReplaceAll(htmlBody, []byte("[ ] "), []byte(`<br><input type="checkbox" disabled> `))
 	htmlBody = bytes.ReplaceAll(htmlBody, []byte("[x] "), []byte(`<br><input type="checkbox" disabled checked> `))
 	htmlBody = bytes.ReplaceAll(htmlBody, []byte("<p><br>"), []byte("<p>"))
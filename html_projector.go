@@ -4,9 +4,8 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
-	"html"
+	"html/template"
 	"log"
-	"net/url"
 	"os"
 	"path/filepath"
 	"slices"
@@ -14,7 +13,6 @@ import (
 	"strconv"
 	"strings"
 	"sync"
-	"text/template"
 	"time"
 
 	"github.com/gomarkdown/markdown"
@@ -31,6 +29,12 @@ var caser = cases.Title(language.English, cases.NoLower)
 
 const sharedPanelsDir = "_panels"
 
+// goJSPrefix and goJSSuffix wrap .gojs sources to render them in JavaScript context.
+const (
+	goJSPrefix = "<script>"
+	goJSSuffix = "</script>"
+)
+
 // HTMLProjector renders the static website from a build graph.
 type HTMLProjector struct {
 	templates *template.Template
@@ -41,23 +45,65 @@ type HTMLProjector struct {
 	templatesDir string
 	outputDir    string
 
-	renderedPanelsCache map[string]string
+	workers int           // number of pages rendered concurrently
+	out     *outputWriter // skips rewriting unchanged files
+	clock   buildClock    // provides page timestamps
+
+	renderedPanelsCache map[string]*renderedPanel
 	graph               *BuildGraph
 	contents            structs.Contents
 
-	muRenderedPanels sync.Mutex // protects writes to renderedPanelsCache
+	muRenderedPanels sync.Mutex // protects renderedPanelsCache map
 	crc32cache       map[string]string
 	crc32mu          sync.Mutex
+
+	evaluator *queryEvaluator // used by graph query template functions
+	queryMu   sync.Mutex      // protects evaluator
 }
 
-func NewHTMLProjector(config structs.Config, infoDir, staticDir, templatesDir, outputDir string) *HTMLProjector {
+// renderedPanel is a panel rendered once and shared between pages.
+type renderedPanel struct {
+	once sync.Once
+	html string
+	err  error
+}
+
+// pageJob is a single page to render by the HTML projector worker pool.
+type pageJob struct {
+	ID       string
+	Template string
+	Data     structs.PageData
+	Sources  []string // info files the page is generated from
+}
+
+// PageError is an error rendering a single page.
+type PageError struct {
+	ID  string
+	Err error
+}
+
+func (e PageError) Error() string {
+	return fmt.Sprintf("page %q: %v", e.ID, e.Err)
+}
+
+func (e PageError) Unwrap() error {
+	return e.Err
+}
+
+func NewHTMLProjector(config structs.Config, infoDir, staticDir, templatesDir, outputDir string, workers int) *HTMLProjector {
+	if workers < 1 {
+		workers = 1
+	}
+
 	return &HTMLProjector{
 		config:              config,
 		infoDir:             infoDir,
 		staticDir:           staticDir,
 		templatesDir:        templatesDir,
 		outputDir:           outputDir,
-		renderedPanelsCache: map[string]string{},
+		workers:             workers,
+		out:                 newOutputWriter(),
+		renderedPanelsCache: map[string]*renderedPanel{},
 		crc32cache:          map[string]string{},
 	}
 }
@@ -151,7 +197,7 @@ func (g *HTMLProjector) fm() template.FuncMap {
 		// "thumbStylePx" returns CSS styles for a thumbnail image,
 		// where background-size is in pixels.
 		// It's used for non-responsive images, and more reliable than "thumbStylePct".
-		"thumbStylePx": func(media structs.Media, max float64, opt ...string) string {
+		"thumbStylePx": func(media structs.Media, max float64, opt ...string) template.CSS {
 			if media.ThumbPath == "" {
 				return ""
 			}
@@ -207,7 +253,7 @@ func (g *HTMLProjector) fm() template.FuncMap {
 				style += fmt.Sprintf("; %sbackground-position: -%.2fpx -%.2fpx", p, positionX, positionY)
 			}
 
-			return style
+			return template.CSS(style)
 		},
 		// "thumbStylePct" returns CSS styles for a thumbnail image,
 		// where background-size is in percents. It's used for responsive images.
@@ -215,7 +261,7 @@ func (g *HTMLProjector) fm() template.FuncMap {
 		// which is the case for most people/characters images.
 		// Also, it doesn't add "comp-margin-left" and "comp-margin-right" styles,
 		// which are used to center the image in lists.
-		"thumbStylePct": func(media structs.Media, prefix ...string) string {
+		"thumbStylePct": func(media structs.Media, prefix ...string) template.CSS {
 			if media.ThumbPath == "" {
 				return ""
 			}
@@ -249,19 +295,19 @@ func (g *HTMLProjector) fm() template.FuncMap {
 			}
 
 			if positionX == 0 && positionY == 0 {
-				return fmt.Sprintf(
+				return template.CSS(fmt.Sprintf(
 					"%sbackground-size: %.2f%% %.2f%%; %saspect-ratio: %d/%d;",
 					p, width, height,
 					p, arX, arY,
-				)
+				))
 			}
 
-			return fmt.Sprintf(
+			return template.CSS(fmt.Sprintf(
 				"%sbackground-size: %.2f%% %.2f%%; %sbackground-position: %.2f%% %.2f%%; %saspect-ratio: %d/%d;",
 				p, width, height,
 				p, positionX, positionY,
 				p, arX, arY,
-			)
+			))
 		},
 		// "isPNG" currenty not used
 		"isPNG": func(path string) bool {
@@ -377,11 +423,11 @@ func (g *HTMLProjector) fm() template.FuncMap {
 		"isLast": func(i, total int) bool {
 			return i == total-1
 		},
-		"escape": func(s string) string {
-			return strings.ReplaceAll(s, `'`, `\'`)
+		// "safeHTML" marks a trusted HTML fragment (e.g. rendered Markdown) as safe to output as is
+		"safeHTML": func(s string) template.HTML {
+			return template.HTML(s)
 		},
-		"htmlEscape": html.EscapeString,
-		"value":      newFileValue,
+		"value": newFileValue,
 		"missing": func() []structs.Missing {
 			if g.graph == nil {
 				return nil
@@ -424,6 +470,17 @@ func (g *HTMLProjector) fm() template.FuncMap {
 		"groupConnections": groupConnections,
 		"escapeFileName":   structs.EscapeFileName,
 		"canonicalPath":    g.canonicalContentPath,
+		// graph query functions, mostly used in .gomd pages (see template_query.go)
+		"query":             g.queryContents,
+		"contentsOfType":    g.contentsOfType,
+		"contentsIn":        g.contentsIn,
+		"where":             g.where,
+		"sortBy":            g.sortBy,
+		"limit":             limit,
+		"connectedFrom":     g.connectedFrom,
+		"connectionsCount":  g.connectionsCount,
+		"sortByConnections": g.sortByConnections,
+		"chain":             g.chain,
 	}
 }
 
@@ -449,6 +506,10 @@ func (g *HTMLProjector) Name() string {
 	return "html"
 }
 
+func (g *HTMLProjector) Outputs() []OutputFile {
+	return g.out.Outputs()
+}
+
 func (g *HTMLProjector) Run(graph *BuildGraph) error {
 	g.graph = graph
 	g.contents = cloneContents(graph.Contents)
@@ -459,7 +520,9 @@ func (g *HTMLProjector) Run(graph *BuildGraph) error {
 	}
 	g.templates = t
 
-	g.copyStaticFiles()
+	if err := g.copyStaticFiles(); err != nil {
+		return fmt.Errorf("copying static files: %w", err)
+	}
 	for _, file := range graph.PassthroughFiles {
 		if err := g.copyFileAsIs(file); err != nil {
 			return fmt.Errorf("copying passthrough file %q: %w", file, err)
@@ -475,38 +538,26 @@ func (g *HTMLProjector) Run(graph *BuildGraph) error {
 		return fmt.Errorf("generating shared panels: %w", err)
 	}
 
-	if err := g.generateMissing(); err != nil {
-		return fmt.Errorf("rendering missing: %w", err)
-	}
-
-	// Generate file templates
-	if err := g.generateContentTemplates(); err != nil {
-		return fmt.Errorf("generating content templates: %w", err)
+	// Render missing pages, content pages, directory indexes and 404 page
+	if err := g.renderPages(g.pageJobs()); err != nil {
+		return fmt.Errorf("rendering pages: %w", err)
 	}
 
-	// Generate index for each directory
-	if err := g.generateIndexes(); err != nil {
-		return fmt.Errorf("generating indexes: %w", err)
-	}
-
-	// Generate 404 page
-	if err := g.generate404(); err != nil {
-		return fmt.Errorf("generating 404 page: %w", err)
-	}
+	log.Printf("HTML output: %s", g.out.Summary())
 
 	return nil
 }
 
-func (g *HTMLProjector) copyStaticFiles() {
+func (g *HTMLProjector) copyStaticFiles() error {
 	if g.staticDir == "" {
 		log.Printf("No static files directory specified, skipping")
-		return
+		return nil
 	}
 
 	log.Printf("Copying static files from %q to %q", g.staticDir, g.outputDir)
 
 	if err := os.MkdirAll(g.outputDir, 0o755); err != nil {
-		log.Fatalf("Error creating output directory %q: %v", g.outputDir, err)
+		return fmt.Errorf("creating output directory %q: %w", g.outputDir, err)
 	}
 
 	err := filepath.Walk(
@@ -526,48 +577,60 @@ func (g *HTMLProjector) copyStaticFiles() {
 			if strings.HasSuffix(path, ".gojs") {
 				outPath = strings.TrimSuffix(outPath, ".gojs") + ".js"
 				log.Printf("Processing GoJS file %q to %q", path, outPath)
-				return g.processGoJSFile(path, outPath)
+				return g.processGoJSFile(path, outPath, filepath.ToSlash(relPath))
 			}
 
-			return copyFile(path, outPath)
+			return g.out.CopyFile(path, outPath, filepath.ToSlash(relPath))
 		},
 	)
 	if err != nil {
-		log.Fatalf("Error walking static directory %q: %v", g.staticDir, err)
+		return fmt.Errorf("walking static directory %q: %w", g.staticDir, err)
 	}
 
 	log.Printf("Done copying static files from %q to %q", g.staticDir, g.outputDir)
+	return nil
 }
 
-func (g *HTMLProjector) processGoJSFile(src, out string) error {
-	// treat file as a Go template
+// processGoJSFile renders a static JavaScript file as a template.
+// The source is wrapped into a <script> element, so html/template escapes
+// values in JavaScript context (e.g. as JS string literals), and the wrapper
+// is stripped from the output. Source is the file's path in the static directory.
+func (g *HTMLProjector) processGoJSFile(src, out, source string) error {
 	b, err := os.ReadFile(src)
 	if err != nil {
 		return fmt.Errorf("reading file: %w", err)
 	}
 
-	t, err := template.New("").Funcs(g.fm()).Parse(string(b))
+	t, err := template.New("").Funcs(g.fm()).Parse(goJSPrefix + string(b) + goJSSuffix)
 	if err != nil {
 		return fmt.Errorf("parsing template: %w", err)
 	}
 
-	outFile, err := os.Create(out)
-	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
+	var buf bytes.Buffer
+	if err = t.Execute(&buf, nil); err != nil {
+		return fmt.Errorf("%w for %q: %w", errExecutingTemplate, src, err)
 	}
-	defer func() { _ = outFile.Close() }()
 
-	if err = t.Execute(outFile, nil); err != nil {
-		return fmt.Errorf("%w for %q: %w", errExecutingTemplate, src, err)
+	rendered, ok := strings.CutPrefix(buf.String(), goJSPrefix)
+	if ok {
+		rendered, ok = strings.CutSuffix(rendered, goJSSuffix)
+	}
+	if !ok {
+		return fmt.Errorf("%w for %q: script wrapper not found in output", errExecutingTemplate, src)
+	}
+
+	if _, err := g.out.WriteFile(out, []byte(rendered), source); err != nil {
+		return fmt.Errorf("writing %q: %w", out, err)
 	}
 
 	return nil
 }
 
 func (g *HTMLProjector) copyFileAsIs(file string) error {
-	return copyFile(
+	return g.out.CopyFile(
 		filepath.Join(g.infoDir, file),
 		filepath.Join(g.outputDir, file),
+		file,
 	)
 }
 
@@ -575,22 +638,24 @@ func (g *HTMLProjector) copyFileAsIs(file string) error {
 // it is an optimisation to not render the same panel multiple times.
 // drawback is that some content still has to be changed dynamically,
 // that is why markInPathLinks function is used
-func (g *HTMLProjector) renderPanel(panel structs.Panel, index int, isLast bool, path string) string {
+func (g *HTMLProjector) renderPanel(panel structs.Panel, index int, isLast bool, path string) (template.HTML, error) {
 	g.muRenderedPanels.Lock()
-	defer g.muRenderedPanels.Unlock()
-
-	if rendered, ok := g.renderedPanelsCache[panel.Dir]; ok {
-		return markInPathLinks(rendered, panel, path, isLast)
+	cached, ok := g.renderedPanelsCache[panel.Dir]
+	if !ok {
+		cached = &renderedPanel{}
+		g.renderedPanelsCache[panel.Dir] = cached
 	}
+	g.muRenderedPanels.Unlock()
 
-	rendered, err := g.renderPanelImpl(panel, index)
-	if err != nil {
-		log.Fatalf("rendering panel %q: %v", path, err)
+	// pages sharing a panel wait for the first one to render it
+	cached.once.Do(func() {
+		cached.html, cached.err = g.renderPanelImpl(panel, index)
+	})
+	if cached.err != nil {
+		return "", fmt.Errorf("rendering panel %q: %w", panel.Dir, cached.err)
 	}
 
-	g.renderedPanelsCache[panel.Dir] = rendered
-
-	return markInPathLinks(rendered, panel, path, isLast)
+	return markInPathLinks(cached.html, panel, path, isLast), nil
 }
 
 func (g *HTMLProjector) renderPanelImpl(panel structs.Panel, index int) (string, error) {
@@ -621,11 +686,16 @@ func sharedPanelPath(dir string) string {
 func (g *HTMLProjector) generateSharedPanels() error {
 	dir := structs.PersonPrefix()
 	path := sharedPanelPath(dir)
-	files, ok := g.graph.DirContents[dir]
-	if path == "" || !ok {
+	if path == "" {
 		return nil
 	}
 
+	files, ok := g.graph.DirContents[dir]
+	if !ok {
+		// remove a panel left from a previous build
+		return g.out.Remove(filepath.Join(g.outputDir, path))
+	}
+
 	rendered, err := g.renderPanelImpl(structs.Panel{
 		Dir:   dir,
 		Files: files,
@@ -635,17 +705,14 @@ func (g *HTMLProjector) generateSharedPanels() error {
 	}
 
 	outputPath := filepath.Join(g.outputDir, path)
-	if err := os.MkdirAll(filepath.Dir(outputPath), 0o755); err != nil {
-		return fmt.Errorf("creating shared panels directory: %w", err)
-	}
-	if err := os.WriteFile(outputPath, []byte(rendered), 0o644); err != nil {
+	if _, err := g.out.WriteFile(outputPath, []byte(rendered)); err != nil {
 		return fmt.Errorf("writing shared panel %q: %w", dir, err)
 	}
 
 	return nil
 }
 
-func markInPathLinks(s string, panel structs.Panel, path string, isLast bool) string {
+func markInPathLinks(s string, panel structs.Panel, path string, isLast bool) template.HTML {
 	if isLast {
 		s = strings.Replace(
 			s,
@@ -659,68 +726,108 @@ func markInPathLinks(s string, panel structs.Panel, path string, isLast bool) st
 		filePath := filepath.Join(panel.Dir, file.Name)
 		if file.IsFolder && strings.HasPrefix(path, filePath) {
 			// add "in-path" class to folder link
-			return strings.Replace(
-				s,
-				`" href="/`+filePath+`/"`,
-				` in-path" href="/`+filePath+`/"`,
-				1,
-			)
+			href := escapedHref(filePath + "/")
+			return template.HTML(strings.Replace(s, `" `+href, ` in-path" `+href, 1))
 		}
 
 		if !file.IsFolder && path == filePath {
 			// add "in-path" and "active" classes to file link
-			return strings.Replace(
-				s,
-				`" href="/`+filePath+`"`,
-				` active in-path" href="/`+filePath+`"`,
-				1,
-			)
+			href := escapedHref(filePath)
+			return template.HTML(strings.Replace(s, `" `+href, ` active in-path" `+href, 1))
+		}
+	}
+
+	return template.HTML(s)
+}
+
+var hrefTemplate = template.Must(template.New("href").Parse(`<a href="/{{ . }}">`))
+
+// escapedHref returns an href attribute for a given path,
+// escaped the same way as in the panel template.
+func escapedHref(path string) string {
+	var b strings.Builder
+	if err := hrefTemplate.Execute(&b, path); err != nil {
+		return `href="/` + path + `"`
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(b.String(), "<a "), ">")
+}
+
+// pageJobs returns all pages to render.
+// If several pages share an output path, the latter one wins:
+// content pages replace missing pages and directory indexes replace content pages.
+func (g *HTMLProjector) pageJobs() []pageJob {
+	var jobs []pageJob
+	jobs = append(jobs, g.missingPageJobs()...)
+	jobs = append(jobs, g.contentPageJobs()...)
+	jobs = append(jobs, g.indexPageJobs()...)
+	jobs = append(jobs, g.notFoundPageJob())
+
+	byPath := make(map[string]int, len(jobs))
+	result := make([]pageJob, 0, len(jobs))
+	for _, job := range jobs {
+		if i, ok := byPath[job.Data.OutputPath]; ok {
+			result[i] = job
+			continue
 		}
+		byPath[job.Data.OutputPath] = len(result)
+		result = append(result, job)
 	}
 
-	return s
+	return result
 }
 
-func (g *HTMLProjector) generateContentTemplates() error {
-	for id, content := range g.contents {
-		path := filepath.Join(g.outputDir, id+".html")
+func (g *HTMLProjector) contentPageJobs() []pageJob {
+	jobs := make([]pageJob, 0, len(g.contents))
+	for _, id := range sortedKeys(g.contents) {
+		content := g.contents[id]
 		panels, breadcrumbs := g.graph.Panels(id, true)
 		cnt := content
 
-		err := g.executeTemplate(path, structs.PageData{
-			CurrentPath:    id,
-			Dir:            filepath.Dir(id),
-			Breadcrumbs:    breadcrumbs,
-			Panels:         panels,
-			Content:        &cnt,
-			Timestamp:      time.Now().Unix(),
-			OpenGraphImage: g.graph.OpenGraphImage(id),
-		}, "index.gohtml")
-		if err != nil {
-			return fmt.Errorf("%w for %q: %w", errExecutingTemplate, id, err)
-		}
+		jobs = append(jobs, pageJob{
+			ID:       id,
+			Template: "index.gohtml",
+			Data: structs.PageData{
+				OutputPath:     filepath.Join(g.outputDir, id+".html"),
+				CurrentPath:    id,
+				Dir:            filepath.Dir(id),
+				Breadcrumbs:    breadcrumbs,
+				Panels:         panels,
+				Content:        &cnt,
+				Timestamp:      g.clock.Now().Unix(),
+				OpenGraphImage: g.graph.OpenGraphImage(id),
+			},
+			Sources: []string{content.Source},
+		})
 	}
 
-	return nil
+	return jobs
 }
 
 func (g *HTMLProjector) generateGoTemplates() error {
-	for path, content := range g.contents {
+	// html/template doesn't allow parsing templates after the first execution,
+	// so all pages are parsed before rendering any of them
+	pages := map[string]*template.Template{}
+	for _, path := range sortedKeys(g.contents) {
+		content := g.contents[path]
 		if filepath.Ext(content.Source) != ".gomd" {
 			continue
 		}
 
-		// render Go template
-		t, err := g.templates.New("").Funcs(g.fm()).Parse(content.HTML)
+		t, err := g.templates.New(content.Source).Parse(content.HTML)
 		if err != nil {
-			return fmt.Errorf("parsing template: %w", err)
+			return fmt.Errorf("parsing template %q: %w", path, err)
 		}
+		pages[path] = t
+	}
 
+	for _, path := range sortedKeys(pages) {
+		t := pages[path]
 		var buf bytes.Buffer
 		if err := t.Execute(&buf, nil); err != nil {
 			return fmt.Errorf("%w for %q: %w", errExecutingTemplate, path, err)
 		}
 
+		content := g.contents[path]
 		htmlBody := markdown.ToHTML(buf.Bytes(), nil, nil)
 		content.HTML = string(htmlBody)
 
@@ -753,103 +860,132 @@ func (g *HTMLProjector) formatTitle(b structs.Breadcrumbs) string {
 	return strings.Join(dirs, " \\ ")
 }
 
-func (g *HTMLProjector) generateIndexes() error {
-	for dir := range g.graph.DirContents {
-		path := filepath.Join(g.outputDir, dir, "index.html")
+func (g *HTMLProjector) indexPageJobs() []pageJob {
+	jobs := make([]pageJob, 0, len(g.graph.DirContents))
+	for _, dir := range sortedKeys(g.graph.DirContents) {
 		panels, breadcrumbs := g.graph.Panels(dir, false)
 
-		err := g.executeTemplate(path, structs.PageData{
-			CurrentPath: dir,
-			Breadcrumbs: breadcrumbs,
-			Panels:      panels,
-			Content:     nil,
-			Timestamp:   time.Now().Unix(),
-			Connections: nil,
-		}, "index.gohtml")
-		if err != nil {
-			return fmt.Errorf("%w for %q: %w", errExecutingTemplate, dir, err)
-		}
+		jobs = append(jobs, pageJob{
+			ID:       dir,
+			Template: "index.gohtml",
+			Data: structs.PageData{
+				OutputPath:     filepath.Join(g.outputDir, dir, "index.html"),
+				CurrentPath:    dir,
+				Breadcrumbs:    breadcrumbs,
+				Panels:         panels,
+				Content:        nil,
+				Timestamp:      g.clock.Now().Unix(),
+				Connections:    nil,
+				OpenGraphImage: g.graph.OpenGraphIndexImage(dir),
+			},
+		})
 	}
 
-	return nil
+	return jobs
 }
 
-func (g *HTMLProjector) generateMissing() error {
-	// create channel with PageData to render
-	pagesDataChan := make(chan structs.PageData)
+func (g *HTMLProjector) missingPageJobs() []pageJob {
+	jobs := make([]pageJob, 0, len(g.graph.MissingPages))
+	for _, missingPage := range g.graph.MissingPages {
+		id := missingPage.ID
+		panels, breadcrumbs := g.graph.Panels(id, true)
 
-	// start 10 workers to render missing files
-	var wg sync.WaitGroup
-	for i := 0; i < 10; i++ {
-		wg.Add(1)
-		go func() {
+		jobs = append(jobs, pageJob{
+			ID:       id,
+			Template: "index.gohtml",
+			Data: structs.PageData{
+				OutputPath:     filepath.Join(g.outputDir, id+".html"),
+				CurrentPath:    id,
+				Dir:            filepath.Dir(id),
+				Breadcrumbs:    breadcrumbs,
+				Panels:         panels,
+				Content:        missingPage.Content,
+				Timestamp:      g.clock.Now().Unix(),
+				OpenGraphImage: g.graph.OpenGraphImage(id),
+			},
+			Sources: g.graph.ReferencingSources(id),
+		})
+	}
+
+	return jobs
+}
+
+func (g *HTMLProjector) notFoundPageJob() pageJob {
+	return pageJob{
+		ID:       "404",
+		Template: "404.gohtml",
+		Data: structs.PageData{
+			OutputPath:  filepath.Join(g.outputDir, "404.html"),
+			CurrentPath: "404",
+			Dir:         "",
+			Breadcrumbs: structs.Breadcrumbs{
+				{Name: g.config.HomeLabel},
+				{Name: g.config.NotFoundHeader, IsCurrent: true},
+			},
+			Panels:    nil, // no panels on 404 page
+			Timestamp: g.clock.Now().Unix(),
+		},
+	}
+}
+
+// renderPages renders pages using a pool of workers.
+// It renders all pages even if some of them fail,
+// and returns errors for every failed page, sorted by page ID.
+func (g *HTMLProjector) renderPages(jobs []pageJob) error {
+	jobsChan := make(chan pageJob)
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   []PageError
+		worker = func() {
 			defer wg.Done()
-			for pd := range pagesDataChan {
-				err := g.executeTemplate(pd.OutputPath, pd, "index.gohtml")
-				if err != nil {
-					log.Fatalf("Error executing template for %q: %v", pd.CurrentPath, err)
+			for job := range jobsChan {
+				if err := g.executeTemplate(job.Data.OutputPath, job.Data, job.Template, job.Sources...); err != nil {
+					mu.Lock()
+					errs = append(errs, PageError{ID: job.ID, Err: err})
+					mu.Unlock()
 				}
 			}
-		}()
-	}
-
-	// render all missing files
-	for _, missingPage := range g.graph.MissingPages {
-		id := missingPage.ID
-		panels, breadcrumbs := g.graph.Panels(id, true)
-		pagesDataChan <- structs.PageData{
-			OutputPath:     filepath.Join(g.outputDir, id+".html"),
-			CurrentPath:    id,
-			Dir:            filepath.Dir(id),
-			Breadcrumbs:    breadcrumbs,
-			Panels:         panels,
-			Content:        missingPage.Content,
-			Timestamp:      time.Now().Unix(),
-			OpenGraphImage: g.graph.OpenGraphImage(id),
 		}
+	)
+
+	for i := 0; i < g.workers; i++ {
+		wg.Add(1)
+		go worker()
 	}
 
-	close(pagesDataChan)
+	for _, job := range jobs {
+		jobsChan <- job
+	}
+	close(jobsChan)
 
 	wg.Wait()
-	return nil
-}
 
-func (g *HTMLProjector) generate404() error {
-	outputPath := filepath.Join(g.outputDir, "404.html")
+	if len(errs) == 0 {
+		return nil
+	}
 
-	return g.executeTemplate(outputPath, structs.PageData{
-		CurrentPath: "404",
-		Dir:         "",
-		Breadcrumbs: structs.Breadcrumbs{
-			{Name: g.config.HomeLabel},
-			{Name: g.config.NotFoundHeader, IsCurrent: true},
-		},
-		Panels:    nil, // no panels on 404 page
-		Timestamp: time.Now().Unix(),
-	}, "404.gohtml")
-}
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].ID < errs[j].ID
+	})
 
-func (g *HTMLProjector) executeTemplate(path string, pageData structs.PageData, templateName string) error {
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
-		return fmt.Errorf("creating directory: %w", err)
+	joined := make([]error, 0, len(errs))
+	for _, err := range errs {
+		joined = append(joined, err)
 	}
 
-	f, err := os.Create(path)
-	if err != nil {
-		return fmt.Errorf("creating file: %w", err)
-	}
+	return fmt.Errorf("%d of %d page%s failed: %w", len(errs), len(jobs), plural(len(jobs)), errors.Join(joined...))
+}
 
-	if err := g.templates.ExecuteTemplate(f, templateName, pageData); err != nil {
-		err2 := f.Close()
-		if err2 != nil {
-			err = errors.Join(err, err2)
-		}
-		return fmt.Errorf("executing template for %q: %w", path, err)
+func (g *HTMLProjector) executeTemplate(path string, pageData structs.PageData, templateName string, sources ...string) error {
+	var buf bytes.Buffer
+	if err := g.templates.ExecuteTemplate(&buf, templateName, pageData); err != nil {
+		return fmt.Errorf("%w for %q: %w", errExecutingTemplate, path, err)
 	}
 
-	if err := f.Close(); err != nil {
-		return fmt.Errorf("closing file: %w", err)
+	if _, err := g.out.WriteFile(path, buf.Bytes(), sources...); err != nil {
+		return fmt.Errorf("writing %q: %w", path, err)
 	}
 
 	return nil
@@ -978,7 +1114,8 @@ func groupConnections(connections map[string][]structs.Connection) []structs.Con
 	//   - Parent1
 	//   - Parent2
 
-	for from, conns := range connections {
+	for _, from := range sortedKeys(connections) {
+		conns := connections[from]
 		line := structs.ConnectionLine{
 			From:    from,
 			Groups:  []structs.ConnectionLineItem{},
@@ -1031,22 +1168,17 @@ func groupConnections(connections map[string][]structs.Connection) []structs.Con
 		result = append(result, line)
 	}
 
-	// sort by "From" field
-	sort.Slice(result, func(i, j int) bool {
-		return result[i].From < result[j].From
-	})
-
 	return result
 }
 
-func newFileValue(content structs.Content, dir string) string {
+func newFileValue(content structs.Content, dir string) (string, error) {
 	b, err := yaml.Marshal(content)
 	if err != nil {
-		log.Fatalf("Error marshaling content: %v", err)
-		return ""
+		return "", fmt.Errorf("marshaling content: %w", err)
 	}
 
 	// todo: add more placeholders depending on dir
 
-	return url.PathEscape(string(b))
+	// escaped by html/template as a part of URL query
+	return string(b), nil
 }
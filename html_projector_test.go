@@ -1,11 +1,12 @@
 package main
 
 import (
+	"errors"
+	"html/template"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
-	"text/template"
 
 	"github.com/alsosee/finder/structs"
 )
@@ -23,7 +24,7 @@ func TestGenerateGoTemplatesDoesNotMutateGraphContents(t *testing.T) {
 		},
 	}
 
-	projector := NewHTMLProjector(structs.Config{}, "", "", "", "")
+	projector := NewHTMLProjector(structs.Config{}, "", "", "", "", 1)
 	projector.graph = graph
 	projector.contents = cloneContents(graph.Contents)
 	projector.templates = template.New("").Funcs(projector.fm())
@@ -42,8 +43,41 @@ func TestGenerateGoTemplatesDoesNotMutateGraphContents(t *testing.T) {
 	}
 }
 
+func TestGenerateGoTemplatesGraphQueryFunctions(t *testing.T) {
+	const id = "Pages/Directors"
+	graph := testQueryGraph()
+	graph.Contents[id] = structs.Content{
+		Source: id + ".gomd",
+		HTML: `{{ range query "type:movie" | sortBy "-released" | limit 2 }}{{ .Name }};{{ end }}` +
+			`{{ range contentsOfType "person" | sortByConnections "Director" | limit 1 }}{{ .Name }}={{ connectionsCount .SourceNoExtention "Director" }};{{ end }}` +
+			`{{ len (contentsIn "Movies/2023") }};` +
+			`{{ range where "name" "heat" (contentsIn "Movies") }}{{ .Name }};{{ end }}` +
+			`{{ strjoin (chain "Movies/2023/Barbie") "," }}`,
+	}
+	graph.ChainPages = map[string]map[bool]string{
+		"Movies/2023/Barbie":    {false: "Movies/2022/Heat"},
+		"Movies/2022/Heat":      {true: "Movies/2023/Barbie"},
+		"Movies/2023/Elemental": {false: "Movies/2023/Barbie"},
+	}
+	graph.ChainPages["Movies/2023/Barbie"][true] = "Movies/2023/Elemental"
+
+	projector := NewHTMLProjector(structs.Config{}, "", "", "", "", 1)
+	projector.graph = graph
+	projector.contents = cloneContents(graph.Contents)
+	projector.templates = template.New("").Funcs(projector.fm())
+
+	if err := projector.generateGoTemplates(); err != nil {
+		t.Fatalf("generateGoTemplates() error = %v", err)
+	}
+
+	want := "Barbie;Elemental;Alice=2;2;Heat;Movies/2022/Heat,Movies/2023/Barbie,Movies/2023/Elemental"
+	if got := projector.contents[id].HTML; !strings.Contains(got, want) {
+		t.Fatalf("rendered %q, want it to contain %q", got, want)
+	}
+}
+
 func TestReferenceTemplateCanonicalizesColonPath(t *testing.T) {
-	projector := NewHTMLProjector(structs.Config{}, "", "", "", "")
+	projector := NewHTMLProjector(structs.Config{}, "", "", "", "", 1)
 	projector.contents = structs.Contents{
 		"Movies/2024/Dune Part Two": {
 			Source: "Movies/2024/Dune Part Two.yml",
@@ -69,10 +103,10 @@ func TestReferenceTemplateCanonicalizesColonPath(t *testing.T) {
 	}
 
 	got := rendered.String()
-	if !strings.Contains(got, `href="/Movies/2024/Dune Part Two"`) {
+	if !strings.Contains(got, `href="/Movies/2024/Dune%20Part%20Two"`) {
 		t.Fatalf("rendered reference %q does not use canonical path", got)
 	}
-	if strings.Contains(got, `href="/Movies/2024/Dune: Part Two"`) {
+	if strings.Contains(got, `href="/Movies/2024/Dune:%20Part%20Two"`) {
 		t.Fatalf("rendered reference %q still uses colon path", got)
 	}
 }
@@ -106,7 +140,7 @@ func TestHTMLProjectorExtractsPeoplePanel(t *testing.T) {
 		},
 	}
 
-	projector := NewHTMLProjector(config, "", "", "templates", outputDir)
+	projector := NewHTMLProjector(config, "", "", "templates", outputDir, 4)
 	if err := projector.Run(graph); err != nil {
 		t.Fatalf("Run() error = %v", err)
 	}
@@ -151,6 +185,107 @@ func TestHTMLProjectorExtractsPeoplePanel(t *testing.T) {
 	}
 }
 
+func TestHTMLProjectorEscapesUserContent(t *testing.T) {
+	outputDir := t.TempDir()
+	staticDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(staticDir, "scripts.gojs"), []byte(`var title = "{{ (config).Title }}";`), 0o644); err != nil {
+		t.Fatalf("WriteFile() error = %v", err)
+	}
+
+	config := structs.Config{
+		Title:     `Finder"</script><script>alert(1)//`,
+		HomeLabel: "Home",
+	}
+	graph := &BuildGraph{
+		Config: config,
+		Contents: structs.Contents{
+			"Movies/Dune Part Two": {
+				Name:        `Dune <script>alert(1)</script>`,
+				Description: `"quoted" & <b>bold</b>`,
+				Source:      "Movies/Dune Part Two.yml",
+				Website:     &structs.Link{URL: "javascript:alert(1)"},
+			},
+		},
+		DirContents: map[string][]structs.File{
+			"": {
+				{Name: "Movies", Title: "Movies", IsFolder: true},
+			},
+			"Movies": {
+				{Name: "Dune Part Two", Title: "Dune <script>"},
+			},
+		},
+	}
+
+	projector := NewHTMLProjector(config, "", staticDir, "templates", outputDir, 4)
+	if err := projector.Run(graph); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	page := mustReadFile(t, filepath.Join(outputDir, "Movies", "Dune Part Two.html"))
+	if strings.Contains(page, "<script>alert(1)") || strings.Contains(page, "<b>bold</b>") {
+		t.Fatalf("page contains unescaped user content: %s", page)
+	}
+	if !strings.Contains(page, "Dune &lt;script&gt;alert(1)&lt;/script&gt;") {
+		t.Fatalf("page does not contain escaped name: %s", page)
+	}
+	if strings.Contains(page, `href="javascript:`) {
+		t.Fatalf("page contains unsafe link: %s", page)
+	}
+	if !strings.Contains(page, `active in-path" href="/Movies/Dune%20Part%20Two"`) {
+		t.Fatalf("page does not mark escaped link as active: %s", page)
+	}
+
+	script := mustReadFile(t, filepath.Join(outputDir, "scripts.js"))
+	if strings.Contains(script, "<script>") || strings.Contains(script, `Finder"`) {
+		t.Fatalf("script contains unescaped config value: %s", script)
+	}
+	if !strings.HasPrefix(script, `var title = "Finder\u0022\u003c\/script\u003e`) {
+		t.Fatalf("script is not escaped as a JS string: %s", script)
+	}
+}
+
+func TestRenderPagesCollectsErrors(t *testing.T) {
+	outputDir := t.TempDir()
+	projector := NewHTMLProjector(structs.Config{}, "", "", "", outputDir, 2)
+	projector.templates = template.Must(template.New("").Funcs(projector.fm()).Parse(
+		`{{ define "page" }}{{ .CurrentPath }}{{ if ne .CurrentPath "A" }} {{ .Content.Name }}{{ end }}{{ end }}`,
+	))
+
+	var jobs []pageJob
+	for _, id := range []string{"C", "A", "B"} {
+		jobs = append(jobs, pageJob{
+			ID:       id,
+			Template: "page",
+			Data: structs.PageData{
+				OutputPath:  filepath.Join(outputDir, id+".html"),
+				CurrentPath: id,
+			},
+		})
+	}
+
+	err := projector.renderPages(jobs)
+	if err == nil {
+		t.Fatalf("renderPages() expected error")
+	}
+
+	msg := err.Error()
+	if !strings.Contains(msg, "2 of 3 pages failed") {
+		t.Fatalf("renderPages() error = %q, expected a summary", msg)
+	}
+	if b, c := strings.Index(msg, `page "B"`), strings.Index(msg, `page "C"`); b == -1 || c == -1 || b > c {
+		t.Fatalf("renderPages() error = %q, expected errors for B and C sorted by ID", msg)
+	}
+
+	var pageErr PageError
+	if !errors.As(err, &pageErr) || pageErr.ID != "B" {
+		t.Fatalf("renderPages() error = %v, expected PageError for B", err)
+	}
+
+	if got := mustReadFile(t, filepath.Join(outputDir, "A.html")); got != "A" {
+		t.Fatalf("A.html = %q, expected page to be rendered despite other failures", got)
+	}
+}
+
 func TestSharedPanelPath(t *testing.T) {
 	if got := sharedPanelPath("People"); got != filepath.Join("_panels", "People.html") {
 		t.Fatalf("sharedPanelPath(People) = %q", got)
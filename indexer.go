@@ -1,87 +1,156 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"regexp"
 	"sort"
 	"strings"
-	"time"
-
-	"github.com/meilisearch/meilisearch-go"
 
 	"github.com/alsosee/finder/structs"
 )
 
-type searchClient interface {
-	Index(uid string) searchIndex
-	GetTask(taskID int64) (*meilisearch.Task, error)
-}
-
-type searchIndex interface {
-	AddDocumentsInBatches(documentsPtr interface{}, batchSize int, primaryKey ...string) ([]meilisearch.TaskInfo, error)
-	DeleteDocuments(identifiers []string) (*meilisearch.TaskInfo, error)
-}
-
-type meiliSearchClient struct {
-	client meilisearch.ServiceManager
-}
-
-func (c meiliSearchClient) Index(uid string) searchIndex {
-	return c.client.Index(uid)
-}
-
-func (c meiliSearchClient) GetTask(taskID int64) (*meilisearch.Task, error) {
-	return c.client.GetTask(taskID)
-}
+// searchRebuildSuffix is added to the index name for the index built by a full rebuild.
+const searchRebuildSuffix = "_rebuild"
 
 type indexUpdatePlan struct {
 	deleteIDs   []string
 	updatePaths []string
 }
 
-// Indexer reads files and writes them to a MeiliSearch index.
+// Indexer reads files and writes them to a search backend.
 type Indexer struct {
-	client searchClient
-	state  map[string]string
-	graph  *BuildGraph
+	backend     SearchBackend
+	state       map[string]string
+	graph       *BuildGraph
+	projections searchProjections
+	settings    structs.SearchSettings // from the config, with synonyms from contents
 }
 
 // NewIndexer creates a new Indexer.
 func NewIndexer(
-	client searchClient,
+	backend SearchBackend,
 	graph *BuildGraph,
 ) *Indexer {
 	return &Indexer{
-		client: client,
-		state:  graph.Hashes,
-		graph:  graph,
+		backend: backend,
+		state:   searchState(graph),
+		graph:   graph,
+	}
+}
+
+// searchState returns hashes of search documents by path:
+// content files, missing pages with the pages referencing them, and directories with a trailing "/".
+func searchState(graph *BuildGraph) map[string]string {
+	state := make(map[string]string, len(graph.Hashes)+len(graph.DirContents))
+	for path, hash := range graph.Hashes {
+		if _, ok := graph.MissingContent[path]; ok {
+			hash = hashStrings(append([]string{hash}, searchReferencedBy(graph, removeFileExtention(path))...)...)
+		}
+		state[path] = hash
+	}
+	for dir, files := range graph.DirContents {
+		if dir == "" {
+			continue // the home page
+		}
+		state[dir+"/"] = searchDirectoryHash(files)
 	}
+	return state
 }
 
-// Index writes graph documents to MeiliSearch.
+// Index writes graph documents to the search backend.
+// The index is rebuilt if the state file was written for another index or other settings.
 func (i *Indexer) Index(stateFile, index, force string) error {
-	state, err := readStateFromFile(stateFile)
+	var err error
+	i.projections, err = newSearchProjections(i.graph.Config.SearchDocuments)
 	if err != nil {
-		return fmt.Errorf("reading state file: %w", err)
+		return err
 	}
+	i.settings = i.graph.Config.SearchSettings
+	i.settings.Synonyms = searchSynonyms(i.graph)
 
-	log.Printf("State file contains %d entries", len(state))
+	settingsHash, err := searchSettingsHash(i.graph.Config.SearchSettings, i.graph.Config.SearchDocuments)
+	if err != nil {
+		return err
+	}
+	next := SearchState{
+		Index:     index,
+		Host:      i.backend.Location(),
+		Settings:  settingsHash,
+		Synonyms:  len(i.settings.Synonyms) > 0,
+		Documents: i.state,
+	}
 
-	if err := i.updateIndex(state, index, force); err != nil {
-		return fmt.Errorf("updating index: %w", err)
+	old, err := readSearchState(stateFile, next)
+	if err != nil {
+		return err
 	}
 
-	if err := writeStateToFile(stateFile, i.state); err != nil {
+	log.Printf("State file contains %d entries", len(old.Documents))
+
+	if old.Synonyms && i.settings.Synonyms == nil {
+		// the last synonyms were removed, an empty set resets them in the index
+		i.settings.Synonyms = map[string][]string{}
+	}
+
+	if reason := old.rebuildReason(next); reason != "" && force != "all" {
+		log.Printf("Rebuilding index %q: %s", index, reason)
+		force = "all"
+	}
+
+	if force == "all" {
+		if err := i.rebuildIndex(index); err != nil {
+			return fmt.Errorf("rebuilding index: %w", err)
+		}
+	} else {
+		if err := i.backend.ApplySettings(index, i.settings); err != nil {
+			return fmt.Errorf("applying index settings: %w", err)
+		}
+
+		if err := i.updateIndex(old.Documents, index, force); err != nil {
+			return fmt.Errorf("updating index: %w", err)
+		}
+	}
+
+	if err := writeSearchState(stateFile, next); err != nil {
 		return fmt.Errorf("writing state file: %w", err)
 	}
 
 	return nil
 }
 
+// rebuildIndex writes all documents to a new index and swaps it with the live one,
+// so that searches see either the old index or the complete new one, and no stale documents are left.
+func (i *Indexer) rebuildIndex(index string) error {
+	next := index + searchRebuildSuffix
+
+	// left by an interrupted rebuild
+	if err := i.backend.DeleteIndex(next); err != nil {
+		return fmt.Errorf("deleting index %q: %w", next, err)
+	}
+
+	if err := i.backend.ApplySettings(next, i.settings); err != nil {
+		return fmt.Errorf("applying index settings: %w", err)
+	}
+
+	if err := i.addToIndex(sortedKeys(i.state), next); err != nil {
+		return fmt.Errorf("adding documents: %w", err)
+	}
+
+	log.Printf("Swapping index %q with %q", index, next)
+	if err := i.backend.Swap(index, next); err != nil {
+		return fmt.Errorf("swapping indexes: %w", err)
+	}
+
+	// the live index is complete, the old one is deleted by the next rebuild if this fails
+	if err := i.backend.DeleteIndex(next); err != nil {
+		log.Printf("Error deleting old index %q: %v", next, err)
+	}
+
+	return nil
+}
+
 func (i *Indexer) updateIndex(oldState map[string]string, index, force string) error {
 	plan, err := i.planUpdate(oldState, force)
 	if err != nil {
@@ -190,35 +259,39 @@ func (i *Indexer) deleteFromIndex(ids []string, index string) error {
 
 	log.Printf("Deleting %d documents from index", len(ids))
 
-	task, err := i.client.Index(index).DeleteDocuments(ids)
-	if err != nil {
-		return err
-	}
-
-	err = i.waitForTask(task.TaskUID, time.Minute*2)
-	if err != nil {
-		return fmt.Errorf("waiting for task %q: %w", task.TaskUID, err)
-	}
-
-	return nil
+	return i.backend.Delete(index, ids)
 }
 
 func (i *Indexer) addToIndex(paths []string, index string) error {
-	documents := []*structs.Content{}
+	documents := []SearchDocument{}
 
 	for _, path := range paths {
-		document, ok := i.graph.Document(path)
+		if dir, ok := strings.CutSuffix(path, "/"); ok {
+			documents = append(documents, searchDirectoryDocument(dir, i.graph.DirContents[dir]))
+			continue
+		}
+
+		content, ok := i.graph.Document(path)
 		if !ok {
 			log.Printf("Document %q not found in graph, skipping", path)
 			continue
 		}
+		document, err := i.projections.For(content).Document(content)
+		if err != nil {
+			return err
+		}
+		if content.IsMissing {
+			if names := searchReferencedBy(i.graph, content.SourceNoExtention); len(names) > 0 {
+				document["referenced_by"] = names
+			}
+		}
 		documents = append(documents, document)
 	}
 
 	return i.addDocumentsToIndex(documents, index)
 }
 
-func (i *Indexer) addDocumentsToIndex(documents []*structs.Content, index string) error {
+func (i *Indexer) addDocumentsToIndex(documents []SearchDocument, index string) error {
 	if len(documents) == 0 {
 		log.Printf("No documents to add to index %q", index)
 		return nil
@@ -226,112 +299,8 @@ func (i *Indexer) addDocumentsToIndex(documents []*structs.Content, index string
 
 	log.Printf("Adding %d documents to index %q", len(documents), index)
 	for _, document := range documents {
-		log.Printf("  %s", document.Source)
-	}
-
-	tasks, err := i.client.Index(index).AddDocumentsInBatches(documents, 100, "ID")
-	if err != nil {
-		return err
-	}
-
-	for _, task := range tasks {
-		err := i.waitForTask(task.TaskUID, time.Minute*2)
-		if err != nil {
-			return fmt.Errorf("waiting for task %q: %w", task.TaskUID, err)
-		}
-	}
-	return err
-}
-
-func (i *Indexer) waitForTask(taskID int64, timeout time.Duration) error {
-	var (
-		task  *meilisearch.Task
-		err   error
-		delay = time.Second
-	)
-
-	for {
-		task, err = i.client.GetTask(taskID)
-		if err != nil {
-			return err
-		}
-
-		if task.Status == "succeeded" || task.Status == "failed" {
-			break
-		}
-
-		time.Sleep(delay)
-
-		// check timeout
-		timeout -= delay
-		if timeout <= 0 {
-			return fmt.Errorf("task timeout")
-		}
-
-		log.Printf("Task %d status: %s", taskID, task.Status)
-	}
-
-	if task.Status == "failed" {
-		return fmt.Errorf("task failed: %s", task.Error)
+		log.Printf("  %s", document["Source"])
 	}
 
-	return nil
-}
-
-func readStateFromFile(stateFile string) (map[string]string, error) {
-	state := make(map[string]string)
-
-	f, err := os.Open(stateFile)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return state, nil
-		}
-		return nil, fmt.Errorf("opening state file: %w", err)
-	}
-	defer func() { _ = f.Close() }()
-
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		line := scanner.Text()
-		if line == "" {
-			continue
-		}
-		parts := strings.Split(line, "\t")
-		if len(parts) != 2 {
-			return nil, fmt.Errorf("invalid state file format")
-		}
-		relPath := parts[0]
-		hash := parts[1]
-		state[relPath] = hash
-	}
-
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("reading state file: %w", err)
-	}
-
-	return state, nil
-}
-
-func writeStateToFile(stateFile string, state map[string]string) error {
-	f, err := os.Create(stateFile)
-	if err != nil {
-		return fmt.Errorf("creating state file: %w", err)
-	}
-	defer func() { _ = f.Close() }()
-
-	stateSlice := make([]string, 0, len(state))
-
-	for relPath, hash := range state {
-		stateSlice = append(stateSlice, fmt.Sprintf("%s\t%s", relPath, hash))
-	}
-
-	sort.Strings(stateSlice)
-
-	for _, line := range stateSlice {
-		if _, err := f.WriteString(line + "\n"); err != nil {
-			return fmt.Errorf("writing state file: %w", err)
-		}
-	}
-
-	return nil
+	return i.backend.Upsert(index, documents)
 }
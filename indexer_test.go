@@ -1,7 +1,9 @@
 package main
 
 import (
+	"path/filepath"
 	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/alsosee/finder/structs"
@@ -62,7 +64,7 @@ func TestIndexerPlanUpdateForceModes(t *testing.T) {
 func TestIndexerUpdateIndexUsesGraphDocumentsAndSearchIDs(t *testing.T) {
 	graph := testSearchGraph()
 	client := &fakeSearchClient{index: &fakeSearchIndex{}}
-	indexer := NewIndexer(client, graph)
+	indexer := NewIndexer(MeilisearchBackend{client: client}, graph)
 
 	err := indexer.updateIndex(map[string]string{
 		"Movies/A.yml":    "old",
@@ -82,6 +84,91 @@ func TestIndexerUpdateIndexUsesGraphDocumentsAndSearchIDs(t *testing.T) {
 	}
 }
 
+func TestIndexerRebuildSwapsNewIndex(t *testing.T) {
+	client := &fakeSearchClient{
+		index: &fakeSearchIndex{},
+		tasks: map[int64]*meilisearch.Task{
+			5: {Status: "failed"},
+			6: {Status: "failed"},
+		},
+	}
+	// both indexes exist, the rebuild index does not
+	client.tasks[5].Error.Code = "index_already_exists"
+	client.tasks[6].Error.Code = "index_not_found"
+	indexer := NewIndexer(MeilisearchBackend{client: client}, testSearchGraph())
+
+	if err := indexer.Index(filepath.Join(t.TempDir(), ".state"), "info", "all"); err != nil {
+		t.Fatalf("Index(all) error = %v", err)
+	}
+
+	want := []string{
+		"delete info_rebuild",
+		"create info",
+		"create info_rebuild",
+		"swap info info_rebuild",
+		"delete info_rebuild",
+	}
+	if !reflect.DeepEqual(client.calls, want) {
+		t.Fatalf("index operations = %v, want %v", client.calls, want)
+	}
+	if want := []string{"Movies_A", "Movies_B", "Movies_C"}; !reflect.DeepEqual(client.index.addedIDs, want) {
+		t.Fatalf("added IDs = %v, want %v", client.index.addedIDs, want)
+	}
+}
+
+func TestIndexerIndexesDirectoriesAndMissingPages(t *testing.T) {
+	graph := testSearchGraph()
+	image := &structs.Media{Path: "A.jpg", ThumbPath: "sheet.jpg"}
+	graph.DirContents = map[string][]structs.File{
+		"":       {{Name: "Movies", IsFolder: true}},
+		"Movies": {{Name: "A", Image: image}, {Name: "B"}, {Name: "C"}},
+	}
+	graph.MissingContent = map[string]*structs.Content{"People/Alice.yml": {Name: "Alice"}}
+	graph.Hashes["People/Alice.yml"] = "missing"
+	graph.Connections = structs.Connections{"People/Alice": {"Movies/A": {{Label: "Director"}}}}
+
+	client := &fakeSearchClient{index: &fakeSearchIndex{}}
+	indexer := NewIndexer(MeilisearchBackend{client: client}, graph)
+	if err := indexer.updateIndex(map[string]string{}, "info", ""); err != nil {
+		t.Fatalf("updateIndex() error = %v", err)
+	}
+
+	documents := map[string]SearchDocument{}
+	for _, document := range client.index.added {
+		documents[document.ID()] = document
+	}
+
+	want := SearchDocument{
+		"ID":     "Movies_",
+		"Source": "Movies/",
+		"name":   "Movies",
+		"path":   "Movies",
+		"type":   "directory",
+		"items":  3,
+		"image":  image,
+	}
+	if !reflect.DeepEqual(documents["Movies_"], want) {
+		t.Fatalf("directory document = %#v, want %#v", documents["Movies_"], want)
+	}
+	if got, want := documents["People_Alice"]["referenced_by"], []string{"A"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("missing page referenced_by = %v, want %v", got, want)
+	}
+	if len(documents) != 5 {
+		t.Fatalf("indexed %d documents, want 3 contents, a missing page and a directory: %v", len(documents), client.index.addedIDs)
+	}
+
+	// a new reference changes the missing page only
+	graph.Contents["Movies/B"] = structs.Content{Source: "Movies/B.yml", Name: "B", Directors: []string{"Alice"}}
+	graph.Connections["People/Alice"]["Movies/B"] = []structs.Connection{{Label: "Director"}}
+	plan, err := NewIndexer(nil, graph).planUpdate(indexer.state, "")
+	if err != nil {
+		t.Fatalf("planUpdate() error = %v", err)
+	}
+	if want := []string{"People/Alice.yml"}; !reflect.DeepEqual(plan.updatePaths, want) {
+		t.Fatalf("plan.updatePaths = %v, want %v", plan.updatePaths, want)
+	}
+}
+
 func testSearchGraph() *BuildGraph {
 	return &BuildGraph{
 		Contents: structs.Contents{
@@ -114,26 +201,54 @@ func testSearchGraph() *BuildGraph {
 
 type fakeSearchClient struct {
 	index *fakeSearchIndex
+	tasks map[int64]*meilisearch.Task // results of tasks other than "succeeded"
+	calls []string                    // index operations
 }
 
 func (c *fakeSearchClient) Index(_ string) searchIndex {
 	return c.index
 }
 
-func (c *fakeSearchClient) GetTask(_ int64) (*meilisearch.Task, error) {
+func (c *fakeSearchClient) GetTask(taskID int64) (*meilisearch.Task, error) {
+	if task, ok := c.tasks[taskID]; ok {
+		return task, nil
+	}
 	return &meilisearch.Task{Status: "succeeded"}, nil
 }
 
+func (c *fakeSearchClient) SwapIndexes(params []*meilisearch.SwapIndexesParams) (*meilisearch.TaskInfo, error) {
+	for _, param := range params {
+		c.calls = append(c.calls, "swap "+strings.Join(param.Indexes, " "))
+	}
+	return &meilisearch.TaskInfo{TaskUID: 4}, nil
+}
+
+func (c *fakeSearchClient) CreateIndex(config *meilisearch.IndexConfig) (*meilisearch.TaskInfo, error) {
+	c.calls = append(c.calls, "create "+config.Uid)
+	return &meilisearch.TaskInfo{TaskUID: 5}, nil
+}
+
+func (c *fakeSearchClient) DeleteIndex(uid string) (*meilisearch.TaskInfo, error) {
+	c.calls = append(c.calls, "delete "+uid)
+	return &meilisearch.TaskInfo{TaskUID: 6}, nil
+}
+
 type fakeSearchIndex struct {
+	added      []SearchDocument
 	addedIDs   []string
 	deletedIDs []string
+	settings   *meilisearch.Settings
+	updates    []*meilisearch.Settings
+	synonyms   []map[string][]string // UpdateSynonyms requests
 }
 
 func (i *fakeSearchIndex) AddDocumentsInBatches(documentsPtr interface{}, _ int, _ ...string) ([]meilisearch.TaskInfo, error) {
-	documents := documentsPtr.([]*structs.Content)
+	documents := documentsPtr.([]SearchDocument)
 	for _, document := range documents {
-		i.addedIDs = append(i.addedIDs, document.ID)
+		i.addedIDs = append(i.addedIDs, document.ID())
 	}
+	i.added = append(i.added, documents...)
+
 	return []meilisearch.TaskInfo{{TaskUID: 1}}, nil
 }
 
@@ -141,3 +256,20 @@ func (i *fakeSearchIndex) DeleteDocuments(identifiers []string) (*meilisearch.Ta
 	i.deletedIDs = append(i.deletedIDs, identifiers...)
 	return &meilisearch.TaskInfo{TaskUID: 2}, nil
 }
+
+func (i *fakeSearchIndex) GetSettings() (*meilisearch.Settings, error) {
+	if i.settings == nil {
+		return &meilisearch.Settings{}, nil
+	}
+	return i.settings, nil
+}
+
+func (i *fakeSearchIndex) UpdateSettings(request *meilisearch.Settings) (*meilisearch.TaskInfo, error) {
+	i.updates = append(i.updates, request)
+	return &meilisearch.TaskInfo{TaskUID: 3}, nil
+}
+
+func (i *fakeSearchIndex) UpdateSynonyms(request *map[string][]string) (*meilisearch.TaskInfo, error) {
+	i.synonyms = append(i.synonyms, *request)
+	return &meilisearch.TaskInfo{TaskUID: 3}, nil
+}
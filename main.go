@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
 	"runtime/pprof"
 	"time"
 
@@ -13,45 +14,74 @@ import (
 
 // Config represents an app configuration.
 type Config struct {
-	InfoDirectory      string `env:"INPUT_INFO" short:"i" long:"info" description:"Directory that contains info files" default:"info"`
-	MediaDirectory     string `env:"INPUT_MEDIA" short:"m" long:"media" description:"Directory that contains media files" default:""`
-	StaticDirectory    string `env:"INPUT_STATIC" short:"s" long:"static" description:"Directory that contains static files" default:""`
-	ConfigFile         string `env:"INPUT_CONFIG" short:"c" long:"config" description:"File that contains config" default:"config.yml"`
-	IgnoreFile         string `env:"INPUT_IGNOREFILE" short:"f" long:"ignore" description:"File that contains ignore patterns" default:".ignore"`
-	TemplatesDirectory string `env:"INPUT_TEMPLATES" short:"t" long:"templates" description:"Directory that contains templates" default:"templates"`
-	OutputDirectory    string `env:"INPUT_OUTPUT" short:"o" long:"output" description:"Directory to output static site" default:"output"`
-	MediaHost          string `env:"INPUT_MEDIA_HOST" short:"M" long:"media-host" description:"Host for media" default:""`
-	OpenGraphHost      string `env:"INPUT_OPENGRAPH_HOST" long:"opengraph-host" description:"Host for generated OpenGraph images" default:""`
-	OpenGraphR2Account string `env:"INPUT_OPENGRAPH_R2_ACCOUNT_ID" long:"opengraph-r2-account-id" description:"Cloudflare account ID for OpenGraph R2 uploads" default:""`
-	OpenGraphR2KeyID   string `env:"INPUT_OPENGRAPH_R2_ACCESS_KEY_ID" long:"opengraph-r2-access-key-id" description:"Cloudflare R2 access key ID for OpenGraph uploads" default:""`
-	OpenGraphR2Secret  string `env:"INPUT_OPENGRAPH_R2_ACCESS_KEY_SECRET" long:"opengraph-r2-access-key-secret" description:"Cloudflare R2 access key secret for OpenGraph uploads" default:""`
-	OpenGraphR2Bucket  string `env:"INPUT_OPENGRAPH_R2_BUCKET" long:"opengraph-r2-bucket" description:"Cloudflare R2 bucket for OpenGraph uploads" default:""`
-	SearchHost         string `env:"INPUT_SEARCH_HOST" short:"h" long:"search-host" description:"Host for search" default:""`
-	SearchAPIKey       string `env:"INPUT_SEARCH_API_KEY" short:"k" long:"search-api-key" description:"API key for search" default:""`
-	Outputs            string `env:"INPUT_OUTPUTS" long:"outputs" description:"comma-separated projectors to run: html,sitemap,search,opengraph,json,markdown,worker-redirects" default:""`
-	WorkerRedirectsOut string `env:"INPUT_WORKER_REDIRECTS_OUTPUT" long:"worker-redirects-output" description:"Path to generated Worker redirects module" default:"worker/src/redirects.generated.js"`
-	NumWorkers         int    `env:"INPUT_NUMWORKERS" short:"w" long:"workers" description:"Number of workers to use" default:"4"`
+	InfoDirectory          string `env:"INPUT_INFO" short:"i" long:"info" description:"Directory that contains info files" default:"info"`
+	MediaDirectory         string `env:"INPUT_MEDIA" short:"m" long:"media" description:"Directory that contains media files" default:""`
+	StaticDirectory        string `env:"INPUT_STATIC" short:"s" long:"static" description:"Directory that contains static files" default:""`
+	ConfigFile             string `env:"INPUT_CONFIG" short:"c" long:"config" description:"File that contains config" default:"config.yml"`
+	IgnoreFile             string `env:"INPUT_IGNOREFILE" short:"f" long:"ignore" description:"File that contains ignore patterns" default:".ignore"`
+	TemplatesDirectory     string `env:"INPUT_TEMPLATES" short:"t" long:"templates" description:"Directory that contains templates" default:"templates"`
+	OutputDirectory        string `env:"INPUT_OUTPUT" short:"o" long:"output" description:"Directory to output static site" default:"output"`
+	MediaHost              string `env:"INPUT_MEDIA_HOST" short:"M" long:"media-host" description:"Host for media" default:""`
+	OpenGraphHost          string `env:"INPUT_OPENGRAPH_HOST" long:"opengraph-host" description:"Host for generated OpenGraph images" default:""`
+	OpenGraphR2Account     string `env:"INPUT_OPENGRAPH_R2_ACCOUNT_ID" long:"opengraph-r2-account-id" description:"Cloudflare account ID for OpenGraph R2 uploads" default:""`
+	OpenGraphR2KeyID       string `env:"INPUT_OPENGRAPH_R2_ACCESS_KEY_ID" long:"opengraph-r2-access-key-id" description:"Cloudflare R2 access key ID for OpenGraph uploads" default:""`
+	OpenGraphR2Secret      string `env:"INPUT_OPENGRAPH_R2_ACCESS_KEY_SECRET" long:"opengraph-r2-access-key-secret" description:"Cloudflare R2 access key secret for OpenGraph uploads" default:""`
+	OpenGraphR2Bucket      string `env:"INPUT_OPENGRAPH_R2_BUCKET" long:"opengraph-r2-bucket" description:"Cloudflare R2 bucket for OpenGraph uploads" default:""`
+	OpenGraphEndpoint      string `env:"INPUT_OPENGRAPH_ENDPOINT" long:"opengraph-endpoint" description:"S3-compatible endpoint for OpenGraph uploads, instead of the R2 account endpoint" default:""`
+	OpenGraphRegion        string `env:"INPUT_OPENGRAPH_REGION" long:"opengraph-region" description:"region of the OpenGraph bucket, used with --opengraph-endpoint" default:"auto"`
+	OpenGraphVirtualHosted bool   `env:"INPUT_OPENGRAPH_VIRTUAL_HOSTED" long:"opengraph-virtual-hosted" description:"address the OpenGraph bucket as <bucket>.<endpoint host> instead of <endpoint>/<bucket>"`
+	SearchHost             string `env:"INPUT_SEARCH_HOST" short:"h" long:"search-host" description:"Host for search" default:""`
+	SearchAPIKey           string `env:"INPUT_SEARCH_API_KEY" short:"k" long:"search-api-key" description:"API key for search" default:""`
+	Outputs                string `env:"INPUT_OUTPUTS" long:"outputs" description:"comma-separated projectors to run: html,sitemap,search,static-search,opengraph,json,markdown,worker-redirects,deploy" default:""`
+	WorkerRedirectsOut     string `env:"INPUT_WORKER_REDIRECTS_OUTPUT" long:"worker-redirects-output" description:"Path to generated Worker redirects module" default:"worker/src/redirects.generated.js"`
+	SitemapGzip            bool   `env:"INPUT_SITEMAP_GZIP" long:"sitemap-gzip" description:"also write sitemaps as .xml.gz and list those in sitemap_index.xml"`
+	NumWorkers             int    `env:"INPUT_NUMWORKERS" short:"w" long:"workers" description:"Number of workers to use" default:"4"`
+	Prune                  bool   `env:"INPUT_PRUNE" long:"prune" description:"remove files from the output directory that were not produced by this build"`
+	DryRun                 bool   `env:"INPUT_DRY_RUN" long:"dry-run" description:"only list files that would be removed, uploaded or deleted"`
+
+	DeployEndpoint      string `env:"INPUT_DEPLOY_ENDPOINT" long:"deploy-endpoint" description:"S3-compatible endpoint to deploy the output directory to, e.g. https://<account>.r2.cloudflarestorage.com" default:""`
+	DeployRegion        string `env:"INPUT_DEPLOY_REGION" long:"deploy-region" description:"region of the deploy bucket" default:"auto"`
+	DeployBucket        string `env:"INPUT_DEPLOY_BUCKET" long:"deploy-bucket" description:"bucket to deploy the output directory to" default:""`
+	DeployPrefix        string `env:"INPUT_DEPLOY_PREFIX" long:"deploy-prefix" description:"key prefix for deployed files" default:""`
+	DeployKeyID         string `env:"INPUT_DEPLOY_ACCESS_KEY_ID" long:"deploy-access-key-id" description:"access key ID for the deploy bucket" default:""`
+	DeploySecret        string `env:"INPUT_DEPLOY_ACCESS_KEY_SECRET" long:"deploy-access-key-secret" description:"access key secret for the deploy bucket" default:""`
+	DeployDelete        bool   `env:"INPUT_DEPLOY_DELETE" long:"deploy-delete" description:"delete objects that are not in the output directory"`
+	DeployVirtualHosted bool   `env:"INPUT_DEPLOY_VIRTUAL_HOSTED" long:"deploy-virtual-hosted" description:"address the deploy bucket as <bucket>.<endpoint host> instead of <endpoint>/<bucket>"`
 
 	SearchMasterKey string        `env:"INPUT_SEARCH_MASTER_KEY" long:"master-key" description:"search master key"`
 	SearchIndexName string        `env:"INPUT_SEARCH_INDEX" long:"index" description:"search index name" default:"info"`
+	SearchDirectory string        `env:"INPUT_SEARCH_DIR" long:"search-dir" description:"write search documents as NDJSON files to this directory instead of Meilisearch"`
 	StateFile       string        `env:"INPUT_SEARCH_STATE" long:"state-file" description:"path to state file" default:".state"`
 	OpenGraphState  string        `env:"INPUT_OPENGRAPH_STATE" long:"opengraph-state" description:"path to OpenGraph image state file" default:".opengraph-state"`
 	Force           string        `env:"INPUT_FORCE" long:"force" description:"force reindexing specified path (\"all\" will reindex everything)" default:""`
 	Timeout         time.Duration `env:"INPUT_TIMEOUT" long:"timeout" description:"search timeout" default:"5s"`
 
+	Reproducible    bool   `env:"INPUT_REPRODUCIBLE" long:"reproducible" description:"produce byte-identical output for the same inputs (implied by SOURCE_DATE_EPOCH)"`
+	SourceDateEpoch string `env:"SOURCE_DATE_EPOCH" long:"source-date-epoch" description:"build time as Unix seconds, used instead of the current time and to clamp file modification times"`
+
 	Profile bool `env:"INPUT_PROFILE" long:"profile" description:"enable profiling"`
 }
 
 var cfg Config // global env config
 
 func main() {
-	if _, err := flags.Parse(&cfg); err != nil {
+	var query QueryCommand
+
+	parser := flags.NewParser(&cfg, flags.Default)
+	parser.SubcommandsOptional = true
+	if _, err := parser.AddCommand("query", "Query the build graph", queryCommandDescription, &query); err != nil {
+		log.Fatalf("Error adding query command: %v", err)
+	}
+	if _, err := parser.Parse(); err != nil {
 		log.Fatalf("Error parsing flags: %v", err)
 	}
 
 	fn := run
+	if parser.Active != nil && parser.Active.Name == "query" {
+		fn = func() error { return query.Run(cfg, os.Stdout) }
+	}
 	if cfg.Profile {
-		fn = profileWrapper(run, "cpu.pprof", "mem.pprof")
+		fn = profileWrapper(fn, "cpu.pprof", "mem.pprof")
 	}
 
 	if err := fn(); err != nil {
@@ -68,41 +98,97 @@ func run() error {
 		}.Run(nil)
 	}
 
-	ignore, err := processIgnoreFile(cfg.InfoDirectory, cfg.IgnoreFile)
+	defer measureTime()()
+
+	clock, err := newBuildClock(cfg)
 	if err != nil {
-		return fmt.Errorf("processing ignore file: %w", err)
+		return err
+	}
+
+	var deploy []Projector
+	if outputs["deploy"] {
+		projector, err := buildDeployProjector(cfg)
+		if err != nil {
+			return err
+		}
+		deploy = append(deploy, projector)
 	}
 
-	config, err := parseConfig(cfg.InfoDirectory, cfg.ConfigFile)
+	graph, err := loadGraph(cfg, outputs["opengraph"])
 	if err != nil {
-		return fmt.Errorf("parsing site config: %w", err)
+		return err
+	}
+
+	projectors := buildProjectors(cfg, graph.Config, outputs, graph.Config.OpenGraphHost, clock)
+	if err := RunProjectors(graph, projectors...); err != nil {
+		return err
 	}
-	overrideConfig(&config, cfg)
 
-	schema, err := LoadSchemaMetadata(cfg.InfoDirectory)
+	if cfg.Prune {
+		pruner := outputPruner{
+			outputDir: cfg.OutputDirectory,
+			dryRun:    cfg.DryRun,
+			keep: []string{
+				cfg.StateFile,
+				cfg.OpenGraphState,
+				cfg.WorkerRedirectsOut,
+				filepath.Join(cfg.OutputDirectory, manifestFile),
+			},
+		}
+		pruned, err := pruner.Prune(projectors)
+		if err != nil {
+			return fmt.Errorf("pruning output directory: %w", err)
+		}
+		if cfg.DryRun {
+			log.Printf("Would prune %d stale file%s from %q", len(pruned), plural(len(pruned)), cfg.OutputDirectory)
+		} else {
+			log.Printf("Pruned %d stale file%s from %q", len(pruned), plural(len(pruned)), cfg.OutputDirectory)
+		}
+	}
+
+	if writesOutput(projectors) {
+		manifest, err := writeManifest(cfg.OutputDirectory, projectors)
+		if err != nil {
+			return err
+		}
+		log.Printf("Manifest lists %d file%s", len(manifest.Files), plural(len(manifest.Files)))
+	}
+
+	// deploy runs last, once the output directory is complete
+	return RunProjectors(graph, deploy...)
+}
+
+// loadGraph scans the info and media directories and builds the graph
+// that projectors and the query command operate on.
+func loadGraph(runtime Config, openGraphEnabled bool) (*BuildGraph, error) {
+	ignore, err := processIgnoreFile(runtime.InfoDirectory, runtime.IgnoreFile)
 	if err != nil {
-		return fmt.Errorf("loading schema metadata: %w", err)
+		return nil, fmt.Errorf("processing ignore file: %w", err)
 	}
-	parser := NewParser(schema)
 
-	scan, err := NewScanner(cfg.InfoDirectory, cfg.MediaDirectory, ignore).Scan()
+	config, err := parseConfig(runtime.InfoDirectory, runtime.ConfigFile)
 	if err != nil {
-		return fmt.Errorf("scanning inputs: %w", err)
+		return nil, fmt.Errorf("parsing site config: %w", err)
 	}
+	overrideConfig(&config, runtime)
 
-	defer measureTime()()
+	schema, err := LoadSchemaMetadata(runtime.InfoDirectory)
+	if err != nil {
+		return nil, fmt.Errorf("loading schema metadata: %w", err)
+	}
+	parser := NewParser(schema)
 
-	graph, err := NewGraphBuilder(config, scan, parser, cfg.InfoDirectory, outputs["opengraph"]).Build()
+	scan, err := NewScanner(runtime.InfoDirectory, runtime.MediaDirectory, ignore).Scan()
 	if err != nil {
-		return fmt.Errorf("building graph: %w", err)
+		return nil, fmt.Errorf("scanning inputs: %w", err)
 	}
 
-	projectors := buildProjectors(cfg, config, outputs, graph.Config.OpenGraphHost)
-	if err := RunProjectors(graph, projectors...); err != nil {
-		return err
+	graph, err := NewGraphBuilder(config, scan, parser, runtime.InfoDirectory, openGraphEnabled).Build()
+	if err != nil {
+		return nil, fmt.Errorf("building graph: %w", err)
 	}
 
-	return nil
+	return graph, nil
 }
 
 func profileWrapper(fn func() error, cpuProfile, memProfile string) func() error {
@@ -111,25 +197,26 @@ func profileWrapper(fn func() error, cpuProfile, memProfile string) func() error
 		if err != nil {
 			return fmt.Errorf("creating cpu profile: %v", err)
 		}
+		defer f.Close()
 		if err := pprof.StartCPUProfile(f); err != nil {
 			return fmt.Errorf("starting cpu profile: %v", err)
 		}
+		defer pprof.StopCPUProfile()
 
-		err = fn()
-		if err != nil {
+		if err := fn(); err != nil {
 			return err
 		}
 
-		// Stop CPU profiling and take a memory snapshot
-		pprof.StopCPUProfile()
-		f, err = os.Create(memProfile)
+		// take a memory snapshot; CPU profiling stops on return
+		mem, err := os.Create(memProfile)
 		if err != nil {
 			return fmt.Errorf("creating memory profile: %v", err)
 		}
-		if err := pprof.WriteHeapProfile(f); err != nil {
+		if err := pprof.WriteHeapProfile(mem); err != nil {
+			mem.Close()
 			return fmt.Errorf("writing memory profile: %v", err)
 		}
-		if err = f.Close(); err != nil {
+		if err = mem.Close(); err != nil {
 			return fmt.Errorf("closing memory profile: %v", err)
 		}
 
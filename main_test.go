@@ -0,0 +1,26 @@
+package main
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+)
+
+func TestProfileWrapperStopsProfilingOnError(t *testing.T) {
+	dir := t.TempDir()
+	cpu, mem := filepath.Join(dir, "cpu.pprof"), filepath.Join(dir, "mem.pprof")
+
+	errRun := errors.New("run failed")
+	if err := profileWrapper(func() error { return errRun }, cpu, mem)(); !errors.Is(err, errRun) {
+		t.Fatalf("profileWrapper() error = %v, want %v", err, errRun)
+	}
+
+	// profiling can only be started again if the failed run stopped it
+	called := false
+	if err := profileWrapper(func() error { called = true; return nil }, cpu, mem)(); err != nil {
+		t.Fatalf("profileWrapper() error = %v", err)
+	}
+	if !called {
+		t.Fatal("profileWrapper() didn't call the wrapped function")
+	}
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+const manifestFile = "manifest.json"
+
+// Manifest describes every file in the output directory produced by projectors.
+// It is written to output/manifest.json and can be used by deploy tooling
+// to find changed files without re-hashing the whole output directory.
+type Manifest struct {
+	Files map[string]ManifestEntry `json:"files"` // path relative to the output directory -> entry
+}
+
+// ManifestEntry describes a single output file.
+type ManifestEntry struct {
+	Size        int64    `json:"size"`
+	SHA256      string   `json:"sha256"`
+	ContentType string   `json:"content_type"`
+	Projector   string   `json:"projector"`
+	Sources     []string `json:"sources,omitempty"`
+}
+
+// contentTypeByExtension is used instead of mime.TypeByExtension,
+// which depends on the system MIME database and would make the manifest differ between machines.
+var contentTypeByExtension = map[string]string{
+	".css":         "text/css; charset=utf-8",
+	".gif":         "image/gif",
+	".gz":          "application/gzip",
+	".html":        "text/html; charset=utf-8",
+	".ico":         "image/x-icon",
+	".jpeg":        "image/jpeg",
+	".jpg":         "image/jpeg",
+	".js":          "text/javascript; charset=utf-8",
+	".json":        "application/json",
+	".md":          "text/markdown; charset=utf-8",
+	".mjs":         "text/javascript; charset=utf-8",
+	".png":         "image/png",
+	".svg":         "image/svg+xml",
+	".txt":         "text/plain; charset=utf-8",
+	".wasm":        "application/wasm",
+	".webmanifest": "application/manifest+json",
+	".webp":        "image/webp",
+	".xml":         "application/xml",
+}
+
+// contentType returns the content type of a file based on its extension.
+func contentType(name string) string {
+	if ct, ok := contentTypeByExtension[strings.ToLower(path.Ext(name))]; ok {
+		return ct
+	}
+	return "application/octet-stream"
+}
+
+// buildManifest collects outputs of the projectors that ran.
+// Entries of the previous manifest owned by projectors that didn't run
+// (e.g. with --outputs=json) are kept as long as their files still exist.
+func buildManifest(outputDir string, projectors []Projector, previous Manifest) (Manifest, error) {
+	manifest := Manifest{Files: map[string]ManifestEntry{}}
+
+	ran := map[string]bool{}
+	for _, projector := range projectors {
+		ran[projector.Name()] = true
+	}
+
+	for _, rel := range sortedKeys(previous.Files) {
+		if ran[outputOwner(rel)] || ran[previous.Files[rel].Projector] {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(outputDir, filepath.FromSlash(rel))); err != nil {
+			continue
+		}
+		manifest.Files[rel] = previous.Files[rel]
+	}
+
+	for _, projector := range projectors {
+		op, ok := projector.(OutputProjector)
+		if !ok {
+			continue
+		}
+
+		for _, file := range op.Outputs() {
+			rel, err := filepath.Rel(outputDir, file.Path)
+			if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				// not in the output directory
+				continue
+			}
+			rel = filepath.ToSlash(rel)
+			if rel == manifestFile {
+				continue
+			}
+
+			data, err := os.ReadFile(file.Path)
+			if errors.Is(err, fs.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return Manifest{}, fmt.Errorf("reading %q: %w", file.Path, err)
+			}
+
+			sum := sha256.Sum256(data)
+			manifest.Files[rel] = ManifestEntry{
+				Size:        int64(len(data)),
+				SHA256:      hex.EncodeToString(sum[:]),
+				ContentType: contentType(rel),
+				Projector:   projector.Name(),
+				Sources:     file.Sources,
+			}
+		}
+	}
+
+	return manifest, nil
+}
+
+// readManifest reads the manifest from the output directory.
+// A missing manifest is not an error.
+func readManifest(outputDir string) (Manifest, error) {
+	manifestPath := filepath.Join(outputDir, manifestFile)
+	data, err := os.ReadFile(manifestPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return Manifest{Files: map[string]ManifestEntry{}}, nil
+	}
+	if err != nil {
+		return Manifest{}, fmt.Errorf("reading manifest %q: %w", manifestPath, err)
+	}
+
+	var manifest Manifest
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, fmt.Errorf("parsing manifest %q: %w", manifestPath, err)
+	}
+	if manifest.Files == nil {
+		manifest.Files = map[string]ManifestEntry{}
+	}
+	return manifest, nil
+}
+
+// writesOutput reports whether any of the projectors writes to the output directory,
+// so that e.g. a --outputs=search run leaves the manifest alone.
+func writesOutput(projectors []Projector) bool {
+	for _, projector := range projectors {
+		if _, ok := projector.(OutputProjector); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// writeManifest updates output/manifest.json with outputs of the projectors that ran.
+func writeManifest(outputDir string, projectors []Projector) (Manifest, error) {
+	previous, err := readManifest(outputDir)
+	if err != nil {
+		return Manifest{}, err
+	}
+
+	manifest, err := buildManifest(outputDir, projectors, previous)
+	if err != nil {
+		return Manifest{}, fmt.Errorf("building manifest: %w", err)
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return Manifest{}, fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	manifestPath := filepath.Join(outputDir, manifestFile)
+	if _, err := newOutputWriter().WriteFile(manifestPath, append(data, '\n')); err != nil {
+		return Manifest{}, fmt.Errorf("writing manifest %q: %w", manifestPath, err)
+	}
+
+	return manifest, nil
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alsosee/finder/structs"
+)
+
+func TestWriteManifest(t *testing.T) {
+	outputDir := t.TempDir()
+	mustWriteFile(t, filepath.Join(outputDir, "Movies", "Heat.html"), "heat")
+	mustWriteFile(t, filepath.Join(outputDir, "style.css"), "body{}")
+	mustWriteFile(t, filepath.Join(outputDir, "data", "graph.json"), "{}")
+
+	previous := []Projector{
+		fakeOutputProjector{name: "json", outputs: []OutputFile{
+			{Path: filepath.Join(outputDir, "data", "graph.json")},
+		}},
+	}
+	if _, err := writeManifest(outputDir, previous); err != nil {
+		t.Fatalf("writeManifest() error = %v", err)
+	}
+
+	// a partial build keeps entries of projectors that didn't run
+	projectors := []Projector{
+		fakeOutputProjector{name: "html", outputs: []OutputFile{
+			{Path: filepath.Join(outputDir, "Movies", "Heat.html"), Sources: []string{"Movies/Heat.yml"}},
+			{Path: filepath.Join(outputDir, "style.css"), Sources: []string{"style.css"}},
+			{Path: filepath.Join(outputDir, "..", "outside.txt")},
+		}},
+	}
+	if _, err := writeManifest(outputDir, projectors); err != nil {
+		t.Fatalf("writeManifest() error = %v", err)
+	}
+
+	manifest, err := readManifest(outputDir)
+	if err != nil {
+		t.Fatalf("readManifest() error = %v", err)
+	}
+
+	want := map[string]ManifestEntry{
+		"Movies/Heat.html": {
+			Size:        4,
+			SHA256:      "5a2a0ed9aa3ab7d82b53e8209b13bf598377870fd38f8e1063bfbe0c4d7d7f96",
+			ContentType: "text/html; charset=utf-8",
+			Projector:   "html",
+			Sources:     []string{"Movies/Heat.yml"},
+		},
+		"style.css": {
+			Size:        6,
+			SHA256:      "7c98040a541657584690ae2a1cc3b42a8b53b159cc60c5d3abbfecbaeac6c94a",
+			ContentType: "text/css; charset=utf-8",
+			Projector:   "html",
+			Sources:     []string{"style.css"},
+		},
+		"data/graph.json": {
+			Size:        2,
+			SHA256:      "44136fa355b3678a1146ad16f7e8649e94fb4fc21fe77e8310c060f61caaff8a",
+			ContentType: "application/json",
+			Projector:   "json",
+		},
+	}
+	if !reflect.DeepEqual(manifest.Files, want) {
+		t.Fatalf("manifest = %#v, want %#v", manifest.Files, want)
+	}
+}
+
+func TestWriteManifestStaticSources(t *testing.T) {
+	outputDir := t.TempDir()
+	staticDir := t.TempDir()
+	mustWriteFile(t, filepath.Join(staticDir, "style.css"), "body{}")
+	mustWriteFile(t, filepath.Join(staticDir, "fonts", "sans.woff2"), "font")
+	mustWriteFile(t, filepath.Join(staticDir, "scripts.gojs"), "var a;")
+
+	projector := NewHTMLProjector(structs.Config{}, "", staticDir, "templates", outputDir, 1)
+	if err := projector.Run(&BuildGraph{}); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	manifest, err := writeManifest(outputDir, []Projector{projector})
+	if err != nil {
+		t.Fatalf("writeManifest() error = %v", err)
+	}
+
+	// static sources are relative to the static directory, like content sources to the info directory
+	for path, want := range map[string][]string{
+		"style.css":        {"style.css"},
+		"fonts/sans.woff2": {"fonts/sans.woff2"},
+		"scripts.js":       {"scripts.gojs"},
+	} {
+		if got := manifest.Files[path].Sources; !reflect.DeepEqual(got, want) {
+			t.Errorf("sources of %s = %v, want %v", path, got, want)
+		}
+	}
+}
+
+func TestWritesOutput(t *testing.T) {
+	if writesOutput([]Projector{SearchProjector{}}) {
+		t.Error("writesOutput(search) = true, want false")
+	}
+	if !writesOutput([]Projector{SearchProjector{}, JSONProjector{}}) {
+		t.Error("writesOutput(search, json) = false, want true")
+	}
+}
@@ -5,20 +5,23 @@ import (
 	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"hash/crc32"
 	"image"
-	"image/color"
 	"image/draw"
 	"image/png"
+	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/alsosee/finder/structs"
 )
 
-const openGraphTemplateVersion = "og-v1"
+const openGraphTemplateVersion = "og-v3"
 
 type OpenGraphState map[string]OpenGraphStateEntry
 
@@ -34,6 +37,7 @@ type OpenGraphStateEntry struct {
 
 type OpenGraphUploader interface {
 	Upload(key string, body []byte, contentType string) error
+	Delete(key string) error
 }
 
 type NoopOpenGraphUploader struct{}
@@ -42,18 +46,67 @@ func (NoopOpenGraphUploader) Upload(_ string, _ []byte, _ string) error {
 	return nil
 }
 
+func (NoopOpenGraphUploader) Delete(_ string) error {
+	return nil
+}
+
 type OpenGraphProjector struct {
 	outputDir string
+	mediaDir  string
+	staticDir string
 	stateFile string
 	force     string
 	host      string
+	dryRun    bool // only report orphaned images
+	workers   int
 	uploader  OpenGraphUploader
+	out       *outputWriter
 }
 
 func (p OpenGraphProjector) Name() string {
 	return "opengraph"
 }
 
+func (p OpenGraphProjector) Outputs() []OutputFile {
+	if p.out == nil {
+		return nil
+	}
+	return p.out.Outputs()
+}
+
+// openGraphCard is an OpenGraph image of a content, a missing page or a directory.
+type openGraphCard struct {
+	id         string // key in the state: content or missing page ID, directory path with a trailing slash
+	key        string
+	sources    []string
+	sourceHash string
+	layout     openGraphLayout
+	title      string
+	subtitle   string
+	picture    *openGraphPicture   // poster or portrait
+	mosaic     []*openGraphPicture // thumbnails of directory items
+}
+
+// decoded returns the card with its pictures decoded, to be drawn.
+func (c openGraphCard) decoded() (openGraphCard, error) {
+	picture, err := c.picture.decoded()
+	if err != nil {
+		return c, err
+	}
+	c.picture = picture
+
+	mosaic := make([]*openGraphPicture, 0, len(c.mosaic))
+	for _, picture := range c.mosaic[:min(len(c.mosaic), openGraphMaxMosaic)] {
+		picture, err := picture.decoded()
+		if err != nil {
+			return c, err
+		}
+		mosaic = append(mosaic, picture)
+	}
+	c.mosaic = mosaic
+	return c, nil
+}
+
 func (p OpenGraphProjector) Run(graph *BuildGraph) error {
 	if p.host == "" {
 		return nil
@@ -61,65 +114,338 @@ func (p OpenGraphProjector) Run(graph *BuildGraph) error {
 	if p.uploader == nil {
 		p.uploader = NoopOpenGraphUploader{}
 	}
+	if p.out == nil {
+		p.out = newOutputWriter()
+	}
 
 	state, err := readOpenGraphState(p.stateFile)
 	if err != nil {
 		return err
 	}
+	layouts, err := loadOpenGraphLayouts(graph.Config, p.staticDir)
+	if err != nil {
+		return err
+	}
 
-	for id, content := range graph.Contents {
-		source := content.Source
-		if source == "" {
-			source = id + ".yml"
-		}
+	cards, err := openGraphCards(graph, layouts, newOpenGraphPictures(p.mediaDir))
+	if err != nil {
+		return err
+	}
 
-		key := openGraphKey(id)
-		url := joinURL(p.host, key)
-		sourceHash := graph.Hashes[source]
-		templateHash := openGraphTemplateHash()
+	width, height := graph.Config.OpenGraph.Width, graph.Config.OpenGraph.Height
+	if width == 0 {
+		width = 1200
+	}
+	if height == 0 {
+		height = 630
+	}
 
+	var jobs []openGraphJob
+	for _, card := range cards {
 		entry := OpenGraphStateEntry{
-			SourceHash:   sourceHash,
-			TemplateHash: templateHash,
-			Key:          key,
-			URL:          url,
-			Width:        graph.Config.OpenGraph.Width,
-			Height:       graph.Config.OpenGraph.Height,
+			SourceHash:   card.sourceHash,
+			TemplateHash: openGraphTemplateHash(card.layout),
+			Key:          card.key,
+			URL:          joinURL(p.host, card.key),
+			Width:        width,
+			Height:       height,
 			ContentType:  "image/png",
 		}
-		if entry.Width == 0 {
-			entry.Width = 1200
+
+		if !p.shouldGenerate(card.id, state[card.id], entry) {
+			// image is up to date, keep the local copy if there is one
+			p.out.Claim(filepath.Join(p.outputDir, card.key), card.sources...)
+			continue
+		}
+		jobs = append(jobs, openGraphJob{card: card, entry: entry})
+	}
+
+	if p.dryRun {
+		for _, job := range jobs {
+			log.Printf("Would generate OpenGraph image %s of %s", job.card.key, job.card.id)
+			// the current image is kept until it's generated again
+			p.out.Claim(filepath.Join(p.outputDir, job.card.key), job.card.sources...)
+		}
+		log.Printf("OpenGraph (dry run): %d to generate, %d unchanged", len(jobs), len(cards)-len(jobs))
+		return p.removeOrphans(state, cards)
+	}
+
+	generateErr := p.generateAll(jobs, state)
+	if generateErr == nil {
+		log.Printf("OpenGraph: %d generated, %d unchanged", len(jobs), len(cards)-len(jobs))
+	}
+
+	// state of images that failed to delete is kept, to retry on the next build
+	orphansErr := p.removeOrphans(state, cards)
+	if err := writeOpenGraphState(p.stateFile, state); err != nil {
+		return err
+	}
+	return errors.Join(generateErr, orphansErr)
+}
+
+// openGraphJob is an image to render and upload.
+type openGraphJob struct {
+	card  openGraphCard
+	entry OpenGraphStateEntry
+}
+
+// openGraphStateFlushEvery is the number of generated images after which the state is written,
+// so that an interrupted run doesn't generate them again.
+const openGraphStateFlushEvery = 100
+
+// generateAll renders and uploads images with a pool of workers, adding them to the state.
+// Failed images are left out of the state and all errors are returned.
+// Uploads are retried by the uploader (see S3Client).
+func (p OpenGraphProjector) generateAll(jobs []openGraphJob, state OpenGraphState) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	queue := make(chan openGraphJob)
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex // guards state, failed and generated
+		failed    []error
+		generated int
+	)
+
+	for i := 0; i < max(p.workers, 1); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range queue {
+				entry, err := p.generate(job.card, job.entry)
+
+				mu.Lock()
+				if err != nil {
+					failed = append(failed, err)
+				} else {
+					state[job.card.id] = entry
+					generated++
+					if generated%openGraphStateFlushEvery == 0 {
+						if err := writeOpenGraphState(p.stateFile, state); err != nil {
+							failed = append(failed, err)
+						}
+					}
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+	wg.Wait()
+
+	if len(failed) > 0 {
+		sort.Slice(failed, func(i, j int) bool { return failed[i].Error() < failed[j].Error() })
+		return fmt.Errorf("%d of %d OpenGraph image%s failed: %w", len(failed), len(jobs), plural(len(jobs)), errors.Join(failed...))
+	}
+	return nil
+}
+
+// generate renders the card, uploads it and writes it to the output directory.
+// It returns the state entry with the hash of the image.
+func (p OpenGraphProjector) generate(card openGraphCard, entry OpenGraphStateEntry) (OpenGraphStateEntry, error) {
+	imageBytes, err := renderOpenGraphCard(card, entry.Width, entry.Height)
+	if err != nil {
+		return entry, fmt.Errorf("rendering OpenGraph image for %q: %w", card.id, err)
+	}
+	entry.SourceHash = entry.SourceHash + ":" + fmt.Sprintf("%x", crc32.ChecksumIEEE(imageBytes))
+
+	if err := p.uploader.Upload(card.key, imageBytes, entry.ContentType); err != nil {
+		return entry, fmt.Errorf("uploading OpenGraph image %q: %w", card.key, err)
+	}
+
+	if _, err := p.out.WriteFile(filepath.Join(p.outputDir, card.key), imageBytes, card.sources...); err != nil {
+		return entry, fmt.Errorf("writing local OpenGraph image: %w", err)
+	}
+
+	return entry, nil
+}
+
+// removeOrphans deletes images that have no card anymore (e.g. of removed contents)
+// from the storage and the output directory, and drops their state entries.
+func (p OpenGraphProjector) removeOrphans(state OpenGraphState, cards []openGraphCard) error {
+	ids := make(map[string]bool, len(cards))
+	keys := make(map[string]bool, len(cards))
+	for _, card := range cards {
+		ids[card.id] = true
+		keys[card.key] = true
+	}
+
+	var orphans []string
+	for _, id := range sortedKeys(state) {
+		if !ids[id] {
+			orphans = append(orphans, id)
+		}
+	}
+	if len(orphans) == 0 {
+		return nil
+	}
+
+	if p.dryRun {
+		for _, id := range orphans {
+			if key := state[id].Key; key == "" || keys[key] {
+				log.Printf("Would drop OpenGraph state of %s", id)
+			} else {
+				log.Printf("Would delete OpenGraph image %s of %s", key, id)
+			}
 		}
-		if entry.Height == 0 {
-			entry.Height = 630
+		log.Printf("OpenGraph (dry run): %d orphaned image%s to delete", len(orphans), plural(len(orphans)))
+		return nil
+	}
+
+	var (
+		failed  []error
+		deleted int
+	)
+	for _, id := range orphans {
+		key := state[id].Key
+		// another card may have taken over the key, e.g. a directory index and a content named "index"
+		if key == "" || keys[key] {
+			log.Printf("Dropped OpenGraph state of %s", id)
+			delete(state, id)
+			continue
 		}
 
-		if !p.shouldGenerate(id, state[id], entry) {
+		if err := p.uploader.Delete(key); err != nil {
+			failed = append(failed, fmt.Errorf("deleting OpenGraph image %q: %w", key, err))
+			continue
+		}
+		if err := p.out.Remove(filepath.Join(p.outputDir, key)); err != nil {
+			failed = append(failed, err)
 			continue
 		}
+		log.Printf("Deleted OpenGraph image %s of %s", key, id)
+		deleted++
+		delete(state, id)
+	}
 
-		imageBytes, err := renderOpenGraphImage(content, entry.Width, entry.Height)
+	log.Printf("OpenGraph: %d orphaned image%s deleted", deleted, plural(deleted))
+	if len(failed) > 0 {
+		return fmt.Errorf("%d of %d orphaned OpenGraph image%s failed: %w", len(failed), len(orphans), plural(len(orphans)), errors.Join(failed...))
+	}
+	return nil
+}
+
+// openGraphCards returns cards for contents, missing pages and directories, in this order.
+func openGraphCards(graph *BuildGraph, layouts openGraphLayouts, pictures *openGraphPictures) ([]openGraphCard, error) {
+	var cards []openGraphCard
+
+	for _, id := range sortedKeys(graph.Contents) {
+		content := graph.Contents[id]
+		source := content.Source
+		if source == "" {
+			source = id + ".yml"
+		}
+
+		card := contentCard(content, layouts.For(content))
+		card.id = id
+		card.key = openGraphKey(id)
+		card.sources = []string{source}
+		card.sourceHash = graph.Hashes[source]
+
+		picture, err := pictures.Picture(content)
 		if err != nil {
-			return fmt.Errorf("rendering OpenGraph image for %q: %w", id, err)
+			return nil, fmt.Errorf("loading picture for %q: %w", id, err)
+		}
+		if picture != nil {
+			card.picture = picture
+			card.sourceHash += "+" + picture.hash
 		}
-		entry.SourceHash = entry.SourceHash + ":" + fmt.Sprintf("%x", crc32.ChecksumIEEE(imageBytes))
 
-		if err := p.uploader.Upload(key, imageBytes, entry.ContentType); err != nil {
-			return fmt.Errorf("uploading OpenGraph image %q: %w", key, err)
+		cards = append(cards, card)
+	}
+
+	for _, missingPage := range graph.MissingPages {
+		id := missingPage.ID
+		content := structs.Content{Source: id + ".yml", SourceNoExtention: id}
+		if missingPage.Content != nil {
+			content = *missingPage.Content
+			content.SourceNoExtention = id
+		}
+
+		sources := graph.ReferencingSources(id)
+		card := contentCard(content, layouts.For(content))
+		card.id = id
+		card.key = openGraphKey(id)
+		card.sources = sources
+		card.subtitle = fmt.Sprintf("referenced by %d page%s", len(sources), plural(len(sources)))
+		card.sourceHash = hashStrings(graph.Hashes[content.Source], card.title, card.subtitle)
+
+		picture, err := pictures.Picture(content)
+		if err != nil {
+			return nil, fmt.Errorf("loading picture for %q: %w", id, err)
+		}
+		if picture != nil {
+			card.picture = picture
+			card.sourceHash += "+" + picture.hash
+		}
+
+		cards = append(cards, card)
+	}
+
+	for _, dir := range sortedKeys(graph.DirContents) {
+		files := graph.DirContents[dir]
+		title := filepath.Base(dir)
+		if dir == "" {
+			title = graph.Config.Title
 		}
 
-		outPath := filepath.Join(p.outputDir, key)
-		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
-			return fmt.Errorf("creating local OpenGraph output dir: %w", err)
+		card := openGraphCard{
+			id:       dir + "/",
+			key:      openGraphIndexKey(dir),
+			layout:   layouts.For(structs.Content{Source: dir}),
+			title:    title,
+			subtitle: fmt.Sprintf("%d item%s", len(files), plural(len(files))),
 		}
-		if err := os.WriteFile(outPath, imageBytes, 0o644); err != nil {
-			return fmt.Errorf("writing local OpenGraph image: %w", err)
+
+		hashed := []string{card.title, card.subtitle}
+		for _, file := range files {
+			hashed = append(hashed, file.Name)
+			if file.IsFolder || file.Image == nil || len(card.mosaic) == openGraphMaxMosaic {
+				continue
+			}
+
+			picture, err := pictures.Picture(structs.Content{
+				SourceNoExtention: filepath.Join(dir, removeFileExtention(file.Name)),
+				Image:             file.Image,
+			})
+			if err != nil {
+				return nil, fmt.Errorf("loading picture for %q: %w", filepath.Join(dir, file.Name), err)
+			}
+			if picture != nil {
+				card.mosaic = append(card.mosaic, picture)
+				hashed = append(hashed, picture.hash)
+			}
 		}
+		card.sourceHash = hashStrings(hashed...)
 
-		state[id] = entry
+		cards = append(cards, card)
 	}
 
-	return writeOpenGraphState(p.stateFile, state)
+	return cards, nil
+}
+
+// contentCard returns a card with the content's title and the subtitle of its layout.
+func contentCard(content structs.Content, layout openGraphLayout) openGraphCard {
+	title := content.Header()
+	if title == "" {
+		title = filepath.Base(content.SourceNoExtention)
+	}
+	return openGraphCard{
+		layout:   layout,
+		title:    title,
+		subtitle: layout.subtitle(content),
+	}
+}
+
+func hashStrings(values ...string) string {
+	sum := sha256.Sum256([]byte(strings.Join(values, "\x00")))
+	return hex.EncodeToString(sum[:])
 }
 
 func (p OpenGraphProjector) shouldGenerate(id string, old, next OpenGraphStateEntry) bool {
@@ -160,20 +486,17 @@ func writeOpenGraphState(path string, state OpenGraphState) error {
 	if path == "" {
 		return nil
 	}
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil && filepath.Dir(path) != "." {
-		return fmt.Errorf("creating OpenGraph state dir: %w", err)
-	}
 
 	b, err := json.MarshalIndent(state, "", "  ")
 	if err != nil {
 		return fmt.Errorf("marshaling OpenGraph state: %w", err)
 	}
-	return os.WriteFile(path, b, 0o644)
-}
 
-func openGraphTemplateHash() string {
-	sum := sha256.Sum256([]byte(openGraphTemplateVersion))
-	return hex.EncodeToString(sum[:])
+	// the state is written during generation too, an interrupted write must not lose it
+	if err := writeFileAtomic(path, b); err != nil {
+		return fmt.Errorf("writing OpenGraph state: %w", err)
+	}
+	return nil
 }
 
 func openGraphKey(id string) string {
@@ -187,6 +510,12 @@ func openGraphKey(id string) string {
 	return filepath.ToSlash(filepath.Join("opengraph", key+".png"))
 }
 
+// openGraphIndexKey returns the key of a directory index image,
+// which matches the directory's index.html.
+func openGraphIndexKey(dir string) string {
+	return openGraphKey(filepath.Join(dir, "index"))
+}
+
 func openGraphURL(host, id string) string {
 	if host == "" || id == "" {
 		return ""
@@ -198,74 +527,127 @@ func joinURL(host, path string) string {
 	return strings.TrimRight(host, "/") + "/" + strings.TrimLeft(path, "/")
 }
 
-func renderOpenGraphImage(content structs.Content, width, height int) ([]byte, error) {
+// renderOpenGraphCard draws the card's title and subtitle in the colours of its layout
+// and, if there is one, its picture: portraits (posters, people) are shown whole on the right,
+// landscape pictures and directory mosaics fill the right part of the card.
+func renderOpenGraphCard(card openGraphCard, width, height int) ([]byte, error) {
+	card, err := card.decoded()
+	if err != nil {
+		return nil, err
+	}
+
 	img := image.NewRGBA(image.Rect(0, 0, width, height))
-	bg := color.RGBA{R: 250, G: 249, B: 246, A: 255}
-	fg := color.RGBA{R: 40, G: 37, B: 35, A: 255}
-	accent := color.RGBA{R: 199, G: 58, B: 74, A: 255}
+	layout := card.layout
+	bg, fg, muted, accent := layout.background, layout.text, layout.muted, layout.accent
+	margin := width / 16
+	top := height / 18
 	draw.Draw(img, img.Bounds(), &image.Uniform{C: bg}, image.Point{}, draw.Src)
-	draw.Draw(img, image.Rect(0, 0, width, height/18), &image.Uniform{C: accent}, image.Point{}, draw.Src)
-	draw.Draw(img, image.Rect(width/16, height/5, width-width/16, height/5+6), &image.Uniform{C: fg}, image.Point{}, draw.Src)
-	draw.Draw(img, image.Rect(width/16, height-height/5, width-width/16, height-height/5+6), &image.Uniform{C: fg}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(0, 0, width, top), &image.Uniform{C: accent}, image.Point{}, draw.Src)
+
+	textRight := width - margin
+	switch {
+	case card.picture != nil:
+		var dr image.Rectangle
+		if card.picture.portrait() {
+			dr = fitRect(card.picture.rect, image.Rect(width-margin-width*2/5, top+margin/2, width-margin, height-margin/2))
+		} else {
+			dr = image.Rect(width*11/20, top, width, height)
+		}
+		drawPicture(img, dr, card.picture)
+		textRight = dr.Min.X - margin/2
+	case len(card.mosaic) > 0:
+		dr := image.Rect(width*11/20, top, width, height)
+		drawMosaic(img, dr, card.mosaic, height/100)
+		textRight = dr.Min.X - margin/2
+	}
 
-	var b strings.Builder
-	title := content.Header()
-	if title == "" {
-		title = filepath.Base(content.SourceNoExtention)
+	draw.Draw(img, image.Rect(margin, height/5, textRight, height/5+6), &image.Uniform{C: fg}, image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(margin, height-height/5, textRight, height-height/5+6), &image.Uniform{C: fg}, image.Point{}, draw.Src)
+
+	// text goes between the two rules
+	box := image.Rect(margin, height/5+6+height/24, textRight, height-height/5-height/24)
+	text := layoutOpenGraphText(card.title, card.subtitle, box.Dx(), box.Dy())
+
+	y := box.Min.Y + (box.Dy()-text.height())/2
+	for _, line := range text.title {
+		drawText(img, line, box.Min.X, y, text.titleScale, fg)
+		y += lineHeight(text.titleScale)
 	}
-	b.WriteString(strings.ToUpper(title))
-	if content.Subtitle != "" {
-		b.WriteString(" / ")
-		b.WriteString(strings.ToUpper(content.Subtitle))
+	if len(text.subtitle) > 0 {
+		y += text.gap()
+	}
+	for _, line := range text.subtitle {
+		drawText(img, line, box.Min.X, y, text.subtitleScale, muted)
+		y += lineHeight(text.subtitleScale)
 	}
 
-	drawBlockText(img, b.String(), width/16, height/3, 8, fg)
+	if logo := layout.logoRect(width, height); !logo.Empty() {
+		drawPicture(img, logo, &openGraphPicture{img: layout.logoImage, rect: layout.logoImage.Bounds()})
+	}
 
 	return encodePNG(img)
 }
 
-func encodePNG(img image.Image) ([]byte, error) {
-	var b bytes.Buffer
-	if err := png.Encode(&b, img); err != nil {
-		return nil, err
-	}
-	return b.Bytes(), nil
+const (
+	openGraphMaxTitleScale    = 10
+	openGraphMinTitleScale    = 4
+	openGraphMaxTitleLines    = 3
+	openGraphMaxSubtitleLines = 2
+)
+
+// openGraphText is the title and subtitle of an OpenGraph image, wrapped and sized to fit the card.
+type openGraphText struct {
+	title         []string
+	titleScale    int
+	subtitle      []string
+	subtitleScale int
 }
 
-func drawBlockText(img *image.RGBA, text string, x, y, scale int, c color.Color) {
-	maxX := img.Bounds().Dx() - x
-	cursorX := x
-	cursorY := y
-	for _, r := range text {
-		if cursorX+6*scale > maxX+x || r == '\n' {
-			cursorX = x
-			cursorY += 8 * scale
-			continue
-		}
-		drawBlockRune(img, r, cursorX, cursorY, scale, c)
-		cursorX += 6 * scale
+func (t openGraphText) gap() int {
+	return lineHeight(t.subtitleScale) / 2
+}
+
+func (t openGraphText) height() int {
+	height := len(t.title) * lineHeight(t.titleScale)
+	if len(t.subtitle) > 0 {
+		height += t.gap() + len(t.subtitle)*lineHeight(t.subtitleScale)
 	}
+	return height
 }
 
-func drawBlockRune(img *image.RGBA, r rune, x, y, scale int, c color.Color) {
-	if r == ' ' {
-		return
+// layoutOpenGraphText picks the largest scale at which the title fits in the box
+// in at most openGraphMaxTitleLines lines; at the smallest scale the title is truncated with an ellipsis.
+func layoutOpenGraphText(title, subtitle string, width, height int) openGraphText {
+	var text openGraphText
+	for scale := openGraphMaxTitleScale; scale >= openGraphMinTitleScale; scale-- {
+		text = openGraphText{
+			title:         wrapText(title, width, scale),
+			titleScale:    scale,
+			subtitleScale: max(scale/2, 3),
+		}
+		text.subtitle = truncateLines(wrapText(subtitle, width, text.subtitleScale), openGraphMaxSubtitleLines, width, text.subtitleScale)
+
+		if len(text.title) <= openGraphMaxTitleLines && text.height() <= height {
+			return text
+		}
 	}
-	pattern := blockFont[r]
-	if pattern == nil {
-		pattern = blockFont['?']
+
+	// the smallest scale: drop the subtitle if needed and truncate the title
+	for len(text.subtitle) > 0 && text.height() > height {
+		text.subtitle = truncateLines(text.subtitle, len(text.subtitle)-1, width, text.subtitleScale)
 	}
-	for row, line := range pattern {
-		for col, bit := range line {
-			if bit != '1' {
-				continue
-			}
-			rect := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
-			draw.Draw(img, rect, &image.Uniform{C: c}, image.Point{}, draw.Src)
-		}
+	maxLines := openGraphMaxTitleLines
+	if len(text.subtitle) == 0 {
+		maxLines = min(height/lineHeight(text.titleScale), openGraphMaxTitleLines+1)
 	}
+	text.title = truncateLines(text.title, maxLines, width, text.titleScale)
+	return text
 }
 
-var blockFont = map[rune][]string{
-	'?': {"111", "001", "011", "000", "010"},
+func encodePNG(img image.Image) ([]byte, error) {
+	var b bytes.Buffer
+	if err := png.Encode(&b, img); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
 }
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Bitmap font used for OpenGraph images.
+//
+// Glyphs are drawn on a grid of font pixels, '#' being a filled pixel.
+// Rows start at the cap height: capitals and digits take 7 rows,
+// lowercase letters start at row 2 (x-height is 5 rows),
+// and descenders take 2 more rows below the baseline.
+// Glyphs are proportional, their width is the length of their rows.
+//
+// Letters with diacritics are composed from a base glyph and a mark
+// (see fontMarks), using Unicode canonical decomposition,
+// e.g. "é" is "e" with an acute accent and "Й" is "И" with a breve.
+const (
+	fontAboveRows = 2                 // rows above the cap height, for marks over capitals
+	fontRows      = fontAboveRows + 9 // rows of a composed glyph: marks, cap height and descender
+	fontBaseline  = fontAboveRows + 7 // first row below the baseline
+	fontLineRows  = fontRows + 1      // rows between tops of two lines
+	fontSpacing   = 1                 // columns between glyphs
+	fontSpace     = 3                 // width of a space
+	fontEllipsis  = '\u2026'          // appended to truncated text
+	fontFallback  = '?'               // drawn for runes without a glyph
+)
+
+type fontGlyph []string
+
+// fontGlyphs covers Basic Latin, letters of Latin-1 and Latin Extended-A that don't decompose,
+// Cyrillic and common typographic punctuation.
+var fontGlyphs = map[rune]fontGlyph{
+	'A': {".###.", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'B': {"####.", "#...#", "#...#", "####.", "#...#", "#...#", "####."},
+	'C': {".###.", "#...#", "#....", "#....", "#....", "#...#", ".###."},
+	'D': {"####.", "#...#", "#...#", "#...#", "#...#", "#...#", "####."},
+	'E': {"#####", "#....", "#....", "####.", "#....", "#....", "#####"},
+	'F': {"#####", "#....", "#....", "####.", "#....", "#....", "#...."},
+	'G': {".###.", "#...#", "#....", "#.###", "#...#", "#...#", ".###."},
+	'H': {"#...#", "#...#", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'I': {"###", ".#.", ".#.", ".#.", ".#.", ".#.", "###"},
+	'J': {"..###", "...#.", "...#.", "...#.", "#..#.", "#..#.", ".##.."},
+	'K': {"#...#", "#..#.", "#.#..", "##...", "#.#..", "#..#.", "#...#"},
+	'L': {"#....", "#....", "#....", "#....", "#....", "#....", "#####"},
+	'M': {"#...#", "##.##", "#.#.#", "#.#.#", "#...#", "#...#", "#...#"},
+	'N': {"#...#", "#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#"},
+	'O': {".###.", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'P': {"####.", "#...#", "#...#", "####.", "#....", "#....", "#...."},
+	'Q': {".###.", "#...#", "#...#", "#...#", "#.#.#", "#..#.", ".##.#"},
+	'R': {"####.", "#...#", "#...#", "####.", "#.#..", "#..#.", "#...#"},
+	'S': {".####", "#....", "#....", ".###.", "....#", "....#", "####."},
+	'T': {"#####", "..#..", "..#..", "..#..", "..#..", "..#..", "..#.."},
+	'U': {"#...#", "#...#", "#...#", "#...#", "#...#", "#...#", ".###."},
+	'V': {"#...#", "#...#", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'W': {"#...#", "#...#", "#...#", "#.#.#", "#.#.#", "#.#.#", ".#.#."},
+	'X': {"#...#", "#...#", ".#.#.", "..#..", ".#.#.", "#...#", "#...#"},
+	'Y': {"#...#", "#...#", ".#.#.", "..#..", "..#..", "..#..", "..#.."},
+	'Z': {"#####", "....#", "...#.", "..#..", ".#...", "#....", "#####"},
+
+	'a': {".....", ".....", ".###.", "....#", ".####", "#...#", ".####"},
+	'b': {"#....", "#....", "####.", "#...#", "#...#", "#...#", "####."},
+	'c': {"....", "....", ".###", "#...", "#...", "#...", ".###"},
+	'd': {"....#", "....#", ".####", "#...#", "#...#", "#...#", ".####"},
+	'e': {".....", ".....", ".###.", "#...#", "#####", "#....", ".###."},
+	'f': {"..##", ".#..", ".#..", "###.", ".#..", ".#..", ".#.."},
+	'g': {".....", ".....", ".####", "#...#", "#...#", "#...#", ".####", "....#", ".###."},
+	'h': {"#....", "#....", "####.", "#...#", "#...#", "#...#", "#...#"},
+	'i': {".#.", "...", "##.", ".#.", ".#.", ".#.", "###"},
+	'j': {"..#", "...", ".##", "..#", "..#", "..#", "..#", "#.#", ".#."},
+	'k': {"#...", "#...", "#..#", "#.#.", "##..", "#.#.", "#..#"},
+	'l': {"##.", ".#.", ".#.", ".#.", ".#.", ".#.", "###"},
+	'm': {".....", ".....", "##.#.", "#.#.#", "#.#.#", "#.#.#", "#.#.#"},
+	'n': {".....", ".....", "####.", "#...#", "#...#", "#...#", "#...#"},
+	'o': {".....", ".....", ".###.", "#...#", "#...#", "#...#", ".###."},
+	'p': {".....", ".....", "####.", "#...#", "#...#", "#...#", "####.", "#....", "#...."},
+	'q': {".....", ".....", ".####", "#...#", "#...#", "#...#", ".####", "....#", "....#"},
+	'r': {"....", "....", "#.##", "##..", "#...", "#...", "#..."},
+	's': {".....", ".....", ".####", "#....", ".###.", "....#", "####."},
+	't': {".#..", ".#..", "###.", ".#..", ".#..", ".#..", "..##"},
+	'u': {".....", ".....", "#...#", "#...#", "#...#", "#...#", ".####"},
+	'v': {".....", ".....", "#...#", "#...#", "#...#", ".#.#.", "..#.."},
+	'w': {".....", ".....", "#...#", "#...#", "#.#.#", "#.#.#", ".#.#."},
+	'x': {".....", ".....", "#...#", ".#.#.", "..#..", ".#.#.", "#...#"},
+	'y': {".....", ".....", "#...#", "#...#", "#...#", "#...#", ".####", "....#", ".###."},
+	'z': {".....", ".....", "#####", "...#.", "..#..", ".#...", "#####"},
+
+	'ı': {"...", "...", "##.", ".#.", ".#.", ".#.", "###"},
+	'ȷ': {"...", "...", ".##", "..#", "..#", "..#", "..#", "#.#", ".#."},
+	'ß': {".##..", "#..#.", "#..#.", "#.#..", "#..#.", "#...#", "#.##."},
+	'Æ': {".####", "#.#..", "#.#..", "####.", "#.#..", "#.#..", "#.###"},
+	'æ': {".....", ".....", "##.#.", "..#.#", ".####", "#.#..", ".#.##"},
+	'Œ': {".####", "#.#..", "#.#..", "#.###", "#.#..", "#.#..", ".####"},
+	'œ': {".....", ".....", ".#.#.", "#.#.#", "#.###", "#.#..", ".#.##"},
+	'Ø': {".###.", "#..##", "#.#.#", "#.#.#", "#.#.#", "##..#", ".###."},
+	'ø': {".....", ".....", ".###.", "#..##", "#.#.#", "##..#", ".###."},
+	'Ł': {".#...", ".#...", ".#.#.", ".##..", "##...", ".#...", ".####"},
+	'ł': {".##.", "..#.", "..##", ".##.", "..#.", "..#.", ".###"},
+	'Đ': {".###.", ".#..#", ".#..#", "####.", ".#..#", ".#..#", ".###."},
+	'đ': {"...#.", "..###", "...#.", ".###.", "#..#.", "#..#.", ".###."},
+	'Ħ': {"#...#", "#####", "#...#", "#####", "#...#", "#...#", "#...#"},
+	'ħ': {"#....", "###..", "#....", "####.", "#...#", "#...#", "#...#"},
+	'Ĳ': {"#..###", "#...#.", "#...#.", "#...#.", "#...#.", "#.#.#.", "#..#.."},
+	'ĳ': {"#..#", "....", "#.##", "#..#", "#..#", "#..#", "#..#", "..##", ".##."},
+	'ĸ': {"....", "....", "#..#", "#.#.", "##..", "#.#.", "#..#"},
+	'Ŀ': {"#....", "#....", "#....", "#..#.", "#....", "#....", "#####"},
+	'ŀ': {"##...", ".#...", ".#...", ".#.#.", ".#...", ".#...", "###.."},
+	'ŉ': {"#......", "#......", "..####.", "..#...#", "..#...#", "..#...#", "..#...#"},
+	'Ŋ': {"#...#", "##..#", "#.#.#", "#..##", "#...#", "#...#", "#...#", "....#", "..##."},
+	'ŋ': {".....", ".....", "####.", "#...#", "#...#", "#...#", "#...#", "....#", "..##."},
+	'Ŧ': {"#####", "..#..", "..#..", ".###.", "..#..", "..#..", "..#.."},
+	'ŧ': {".#..", ".#..", "###.", ".#..", "###.", ".#..", "..##"},
+	'ſ': {"..##", ".#..", ".#..", ".#..", ".#..", ".#..", ".#.."},
+	'Þ': {"#....", "####.", "#...#", "#...#", "####.", "#....", "#...."},
+	'þ': {"#....", "#....", "####.", "#...#", "#...#", "#...#", "####.", "#....", "#...."},
+	'ð': {".#.#.", "..#..", ".#.#.", "....#", ".####", "#...#", ".###."},
+
+	'0': {".###.", "#...#", "#..##", "#.#.#", "##..#", "#...#", ".###."},
+	'1': {"..#..", ".##..", "..#..", "..#..", "..#..", "..#..", ".###."},
+	'2': {".###.", "#...#", "....#", "...#.", "..#..", ".#...", "#####"},
+	'3': {"#####", "...#.", "..#..", "...#.", "....#", "#...#", ".###."},
+	'4': {"...#.", "..##.", ".#.#.", "#..#.", "#####", "...#.", "...#."},
+	'5': {"#####", "#....", "####.", "....#", "....#", "#...#", ".###."},
+	'6': {"..##.", ".#...", "#....", "####.", "#...#", "#...#", ".###."},
+	'7': {"#####", "....#", "...#.", "..#..", ".#...", ".#...", ".#..."},
+	'8': {".###.", "#...#", "#...#", ".###.", "#...#", "#...#", ".###."},
+	'9': {".###.", "#...#", "#...#", ".####", "....#", "...#.", ".##.."},
+
+	'.':  {".", ".", ".", ".", ".", ".", "#"},
+	',':  {"..", "..", "..", "..", "..", ".#", ".#", "#."},
+	':':  {".", ".", "#", ".", ".", ".", "#"},
+	';':  {"..", "..", ".#", "..", "..", ".#", ".#", "#."},
+	'!':  {"#", "#", "#", "#", "#", ".", "#"},
+	'?':  {".###.", "#...#", "....#", "...#.", "..#..", ".....", "..#.."},
+	'\'': {"#", "#"},
+	'"':  {"#.#", "#.#"},
+	'‘':  {".#", "#.", "##"},
+	'’':  {"##", ".#", "#."},
+	'‚':  {"..", "..", "..", "..", "..", "##", ".#", "#."},
+	'“':  {".#.#", "#.#.", "####"},
+	'”':  {"####", ".#.#", "#.#."},
+	'„':  {"....", "....", "....", "....", "....", "####", ".#.#", "#.#."},
+	'«':  {".....", ".....", "..#.#", ".#.#.", "#.#..", ".#.#.", "..#.#"},
+	'»':  {".....", ".....", "#.#..", ".#.#.", "..#.#", ".#.#.", "#.#.."},
+	'(':  {".#", "#.", "#.", "#.", "#.", "#.", ".#"},
+	')':  {"#.", ".#", ".#", ".#", ".#", ".#", "#."},
+	'[':  {"##", "#.", "#.", "#.", "#.", "#.", "##"},
+	']':  {"##", ".#", ".#", ".#", ".#", ".#", "##"},
+	'{':  {"..#", ".#.", ".#.", "#..", ".#.", ".#.", "..#"},
+	'}':  {"#..", ".#.", ".#.", "..#", ".#.", ".#.", "#.."},
+	'<':  {"...#", "..#.", ".#..", "#...", ".#..", "..#.", "...#"},
+	'>':  {"#...", ".#..", "..#.", "...#", "..#.", ".#..", "#..."},
+	'-':  {"....", "....", "....", "####"},
+	'‐':  {"....", "....", "....", "####"},
+	'–':  {".....", ".....", ".....", "#####"},
+	'—':  {".......", ".......", ".......", "#######"},
+	'_':  {".....", ".....", ".....", ".....", ".....", ".....", ".....", "#####"},
+	'/':  {"....#", "...#.", "...#.", "..#..", ".#...", ".#...", "#...."},
+	'\\': {"#....", ".#...", ".#...", "..#..", "...#.", "...#.", "....#"},
+	'|':  {"#", "#", "#", "#", "#", "#", "#"},
+	'&':  {".##..", "#..#.", "#.#..", ".#...", "#.#.#", "#..#.", ".##.#"},
+	'+':  {".....", ".....", "..#..", "..#..", "#####", "..#..", "..#.."},
+	'=':  {".....", ".....", ".....", "#####", ".....", "#####"},
+	'*':  {".....", "..#..", "#.#.#", ".###.", "#.#.#", "..#.."},
+	'%':  {"##...", "##..#", "...#.", "..#..", ".#...", "#..##", "...##"},
+	'#':  {".#.#.", ".#.#.", "#####", ".#.#.", "#####", ".#.#.", ".#.#."},
+	'@':  {".###.", "#...#", "#.###", "#.#.#", "#.###", "#....", ".####"},
+	'$':  {"..#..", ".####", "#.#..", ".###.", "..#.#", "####.", "..#.."},
+	'€':  {"..###", ".#...", "####.", ".#...", "####.", ".#...", "..###"},
+	'~':  {".....", ".....", ".....", ".#..#", "#.##."},
+	'^':  {".#.", "#.#"},
+	'`':  {"#.", ".#"},
+	'·':  {".", ".", ".", "#"},
+	'°':  {".#.", "#.#", ".#."},
+	'…':  {".....", ".....", ".....", ".....", ".....", ".....", "#.#.#"},
+	'№':  {"#..#...", "#..#...", "##.#.#.", "#.##.#.", "#..#.#.", "#..#...", "#..#.##"},
+
+	'Б': {"#####", "#....", "#....", "####.", "#...#", "#...#", "####."},
+	'Г': {"#####", "#....", "#....", "#....", "#....", "#....", "#...."},
+	'Д': {".###.", ".#.#.", ".#.#.", ".#.#.", ".#.#.", ".#.#.", "#####", "#...#"},
+	'Ж': {"#.#.#", "#.#.#", "#.#.#", ".###.", "#.#.#", "#.#.#", "#.#.#"},
+	'З': {".###.", "#...#", "....#", "..##.", "....#", "#...#", ".###."},
+	'И': {"#...#", "#...#", "#..##", "#.#.#", "##..#", "#...#", "#...#"},
+	'Л': {"..###", ".#..#", ".#..#", ".#..#", ".#..#", ".#..#", "#...#"},
+	'П': {"#####", "#...#", "#...#", "#...#", "#...#", "#...#", "#...#"},
+	'У': {"#...#", "#...#", "#...#", ".####", "....#", "#...#", ".###."},
+	'Ф': {"..#..", ".###.", "#.#.#", "#.#.#", "#.#.#", ".###.", "..#.."},
+	'Ц': {"#..#.", "#..#.", "#..#.", "#..#.", "#..#.", "#..#.", "#####", "....#"},
+	'Ч': {"#...#", "#...#", "#...#", ".####", "....#", "....#", "....#"},
+	'Ш': {"#.#.#", "#.#.#", "#.#.#", "#.#.#", "#.#.#", "#.#.#", "#####"},
+	'Щ': {"#.#.#.", "#.#.#.", "#.#.#.", "#.#.#.", "#.#.#.", "#.#.#.", "######", ".....#"},
+	'Ъ': {"##...", ".#...", ".#...", ".###.", ".#..#", ".#..#", ".###."},
+	'Ы': {"#...#", "#...#", "#...#", "##..#", "#.#.#", "#.#.#", "##..#"},
+	'Ь': {"#....", "#....", "#....", "####.", "#...#", "#...#", "####."},
+	'Э': {".###.", "#...#", "....#", "..###", "....#", "#...#", ".###."},
+	'Ю': {"#..#.", "#.#.#", "#.#.#", "###.#", "#.#.#", "#.#.#", "#..#."},
+	'Я': {".####", "#...#", "#...#", ".####", "..#.#", ".#..#", "#...#"},
+	'Є': {".###.", "#...#", "#....", "###..", "#....", "#...#", ".###."},
+	'Ґ': {"....#", "#####", "#....", "#....", "#....", "#....", "#...."},
+
+	'б': {"...##", ".##..", "#....", "####.", "#...#", "#...#", ".###."},
+	'в': {".....", ".....", "####.", "#...#", "####.", "#...#", "####."},
+	'г': {"....", "....", "####", "#...", "#...", "#...", "#..."},
+	'д': {".....", ".....", ".###.", ".#.#.", ".#.#.", ".#.#.", "#####", "#...#"},
+	'ж': {".....", ".....", "#.#.#", "#.#.#", ".###.", "#.#.#", "#.#.#"},
+	'з': {".....", ".....", ".###.", "#...#", "..##.", "#...#", ".###."},
+	'и': {".....", ".....", "#...#", "#..##", "#.#.#", "##..#", "#...#"},
+	'к': {"....", "....", "#..#", "#.#.", "##..", "#.#.", "#..#"},
+	'л': {".....", ".....", "..###", ".#..#", ".#..#", ".#..#", "#...#"},
+	'м': {".....", ".....", "#...#", "##.##", "#.#.#", "#...#", "#...#"},
+	'н': {".....", ".....", "#...#", "#...#", "#####", "#...#", "#...#"},
+	'п': {".....", ".....", "#####", "#...#", "#...#", "#...#", "#...#"},
+	'т': {".....", ".....", "#####", "..#..", "..#..", "..#..", "..#.."},
+	'ф': {"..#..", "..#..", ".###.", "#.#.#", "#.#.#", "#.#.#", ".###.", "..#..", "..#.."},
+	'ц': {".....", ".....", "#..#.", "#..#.", "#..#.", "#..#.", "#####", "....#"},
+	'ч': {".....", ".....", "#...#", "#...#", ".####", "....#", "....#"},
+	'ш': {".....", ".....", "#.#.#", "#.#.#", "#.#.#", "#.#.#", "#####"},
+	'щ': {"......", "......", "#.#.#.", "#.#.#.", "#.#.#.", "#.#.#.", "######", ".....#"},
+	'ъ': {".....", ".....", "##...", ".#...", ".###.", ".#..#", ".###."},
+	'ы': {".....", ".....", "#...#", "#...#", "##..#", "#.#.#", "##..#"},
+	'ь': {"....", "....", "#...", "#...", "###.", "#..#", "###."},
+	'э': {".....", ".....", ".###.", "#...#", "..###", "#...#", ".###."},
+	'ю': {".....", ".....", "#..#.", "#.#.#", "###.#", "#.#.#", "#..#."},
+	'я': {".....", ".....", ".####", "#...#", ".####", ".#..#", "#...#"},
+	'є': {"....", "....", ".###", "#...", "###.", "#...", ".###"},
+	'ґ': {"....", "...#", "####", "#...", "#...", "#...", "#..."},
+}
+
+// fontAliases maps runes to glyphs that look the same.
+var fontAliases = map[rune]rune{
+	'А': 'A', 'В': 'B', 'Е': 'E', 'К': 'K', 'М': 'M', 'Н': 'H', 'О': 'O',
+	'Р': 'P', 'С': 'C', 'Т': 'T', 'Х': 'X', 'І': 'I', 'Ј': 'J', 'Ѕ': 'S',
+	'а': 'a', 'е': 'e', 'о': 'o', 'р': 'p', 'с': 'c', 'у': 'y', 'х': 'x',
+	'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'\u00a0': ' ', '\u2009': ' ', '\u202f': ' ',
+	'Ð': 'Đ', '−': '-', '′': '\'', '″': '"', '×': 'x',
+}
+
+// fontMarks are combining marks drawn above (or, for cedilla and ogonek, below) base glyphs.
+var fontMarks = map[rune]fontGlyph{
+	'\u0300': {"#..", ".#."},   // grave
+	'\u0301': {"..#", ".#."},   // acute
+	'\u0302': {".#.", "#.#"},   // circumflex
+	'\u0303': {".#.#", "#.#."}, // tilde
+	'\u0304': {"###", "..."},   // macron
+	'\u0306': {"#..#", ".##."}, // breve
+	'\u0307': {"#", "."},       // dot above
+	'\u0308': {"#.#", "..."},   // diaeresis
+	'\u030a': {".#.", "#.#"},   // ring above
+	'\u030b': {".#.#", "#.#."}, // double acute
+	'\u030c': {"#.#", ".#."},   // caron
+	'\u0327': {".#.", "##."},   // cedilla
+	'\u0328': {".#.", "..#"},   // ogonek
+}
+
+var fontMarksBelow = map[rune]bool{'\u0327': true, '\u0328': true}
+
+// textGlyph is a composed glyph: fontRows rows of equal width.
+type textGlyph []string
+
+func (g textGlyph) width() int {
+	if len(g) == 0 {
+		return 0
+	}
+	return len(g[0])
+}
+
+// glyphFor returns the composed glyph for a rune.
+func glyphFor(r rune) textGlyph {
+	if alias, ok := fontAliases[r]; ok {
+		r = alias
+	}
+	if r == ' ' {
+		return blankGlyph(fontSpace)
+	}
+	if glyph, ok := baseGlyph(r); ok {
+		return composeGlyph(glyph, nil)
+	}
+
+	// letters with diacritics: base letter followed by combining marks
+	decomposed := norm.NFD.String(string(r))
+	base, size := utf8.DecodeRuneInString(decomposed)
+	marks := []rune(decomposed[size:])
+	switch base {
+	case 'i', 'і':
+		base = 'ı'
+	case 'j', 'ј':
+		base = 'ȷ'
+	}
+	glyph, ok := baseGlyph(base)
+	if !ok || len(marks) == 0 {
+		return composeGlyph(fontGlyphs[fontFallback], nil)
+	}
+	for _, mark := range marks {
+		if _, ok := fontMarks[mark]; !ok {
+			return composeGlyph(fontGlyphs[fontFallback], nil)
+		}
+	}
+	return composeGlyph(glyph, marks)
+}
+
+func baseGlyph(r rune) (fontGlyph, bool) {
+	if alias, ok := fontAliases[r]; ok {
+		r = alias
+	}
+	glyph, ok := fontGlyphs[r]
+	return glyph, ok
+}
+
+func blankGlyph(width int) textGlyph {
+	glyph := make(textGlyph, fontRows)
+	for i := range glyph {
+		glyph[i] = strings.Repeat(".", width)
+	}
+	return glyph
+}
+
+// composeGlyph places a base glyph on the full grid and draws marks over it.
+// Marks above sit right over the first non-empty row of the base glyph.
+func composeGlyph(base fontGlyph, marks []rune) textGlyph {
+	width := len(base[0])
+	for _, mark := range marks {
+		width = max(width, len(fontMarks[mark][0]))
+	}
+
+	rows := make([][]byte, fontRows)
+	for i := range rows {
+		rows[i] = []byte(strings.Repeat(".", width))
+	}
+	offset := (width - len(base[0])) / 2
+	for i, line := range base {
+		copy(rows[fontAboveRows+i][offset:], line)
+	}
+
+	top := fontAboveRows
+	for top < fontBaseline && !strings.Contains(string(rows[top]), "#") {
+		top++
+	}
+
+	for _, mark := range marks {
+		glyph := fontMarks[mark]
+		row := top - len(glyph)
+		if fontMarksBelow[mark] {
+			row = fontBaseline
+		}
+		if row < 0 {
+			row = 0
+		}
+		col := (width - len(glyph[0])) / 2
+		for i, line := range glyph {
+			for j := range line {
+				if line[j] == '#' && row+i < fontRows {
+					rows[row+i][col+j] = '#'
+				}
+			}
+		}
+		if !fontMarksBelow[mark] {
+			top = row
+		}
+	}
+
+	glyph := make(textGlyph, fontRows)
+	for i := range rows {
+		glyph[i] = string(rows[i])
+	}
+	return glyph
+}
+
+// textWidth returns the width of text in pixels at the given scale.
+func textWidth(text string, scale int) int {
+	width := 0
+	for i, r := range []rune(text) {
+		if i > 0 {
+			width += fontSpacing
+		}
+		width += glyphFor(r).width()
+	}
+	return width * scale
+}
+
+// lineHeight returns the distance between two lines of text in pixels at the given scale.
+func lineHeight(scale int) int {
+	return fontLineRows * scale
+}
+
+// drawText draws a single line of text with its top-left corner at (x, y).
+func drawText(img *image.RGBA, text string, x, y, scale int, c color.Color) {
+	src := &image.Uniform{C: c}
+	for _, r := range text {
+		glyph := glyphFor(r)
+		for row, line := range glyph {
+			for col := 0; col < len(line); col++ {
+				if line[col] != '#' {
+					continue
+				}
+				rect := image.Rect(x+col*scale, y+row*scale, x+(col+1)*scale, y+(row+1)*scale)
+				draw.Draw(img, rect, src, image.Point{}, draw.Src)
+			}
+		}
+		x += (glyph.width() + fontSpacing) * scale
+	}
+}
+
+// wrapText splits text into lines no wider than maxWidth pixels,
+// breaking at spaces, or inside words longer than a line.
+func wrapText(text string, maxWidth, scale int) []string {
+	var (
+		lines []string
+		line  string
+	)
+	for _, word := range strings.Fields(text) {
+		candidate := word
+		if line != "" {
+			candidate = line + " " + word
+		}
+		if textWidth(candidate, scale) <= maxWidth {
+			line = candidate
+			continue
+		}
+		if line != "" {
+			lines = append(lines, line)
+			line = ""
+		}
+
+		// break words that don't fit on a line of their own, at least one rune per line,
+		// so a glyph wider than the line is left overflowing it
+		for utf8.RuneCountInString(word) > 1 && textWidth(word, scale) > maxWidth {
+			runes := []rune(word)
+			n := len(runes) - 1
+			for n > 1 && textWidth(string(runes[:n]), scale) > maxWidth {
+				n--
+			}
+			lines = append(lines, string(runes[:n]))
+			word = string(runes[n:])
+		}
+		line = word
+	}
+	if line != "" {
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+// truncateLines keeps at most maxLines lines, ending the last kept line with an ellipsis
+// if some text was cut.
+func truncateLines(lines []string, maxLines, maxWidth, scale int) []string {
+	if len(lines) <= maxLines {
+		return lines
+	}
+	if maxLines < 1 {
+		return nil
+	}
+
+	result := append([]string(nil), lines[:maxLines]...)
+	last := []rune(result[maxLines-1])
+	for len(last) > 0 && textWidth(string(last)+string(fontEllipsis), scale) > maxWidth {
+		last = last[:len(last)-1]
+	}
+	result[maxLines-1] = strings.TrimRightFunc(string(last), unicode.IsSpace) + string(fontEllipsis)
+	return result
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/alsosee/finder/structs"
+)
+
+const openGraphDefaultLayout = "default"
+
+// openGraphLayoutDefaults are used for colours a layout doesn't set.
+var openGraphLayoutDefaults = structs.OpenGraphLayout{
+	Background: "#faf9f6",
+	Accent:     "#c73a4a",
+	Text:       "#282523",
+}
+
+var openGraphLogoCorners = map[string]bool{
+	"top-left":     true,
+	"top-right":    true,
+	"bottom-left":  true,
+	"bottom-right": true,
+}
+
+// openGraphLayout is a layout from the site config ready to be drawn.
+type openGraphLayout struct {
+	background color.RGBA
+	accent     color.RGBA
+	text       color.RGBA
+	muted      color.RGBA // subtitle, between text and background
+	fields     []string
+	logo       string
+	logoImage  image.Image
+	hash       string // changes when the layout or its logo changes
+}
+
+// openGraphLayouts are layouts by root type directory.
+type openGraphLayouts map[string]openGraphLayout
+
+// loadOpenGraphLayouts parses layouts from the site config.
+// The logo is read from the static directory only if a layout shows it.
+func loadOpenGraphLayouts(config structs.Config, staticDir string) (openGraphLayouts, error) {
+	layouts := openGraphLayouts{}
+	var logo image.Image
+	var logoHash string
+
+	defined := config.OpenGraph.Layouts
+	if _, ok := defined[openGraphDefaultLayout]; !ok {
+		defined = make(map[string]structs.OpenGraphLayout, len(config.OpenGraph.Layouts)+1)
+		for name, layout := range config.OpenGraph.Layouts {
+			defined[name] = layout
+		}
+		defined[openGraphDefaultLayout] = structs.OpenGraphLayout{}
+	}
+
+	for _, name := range sortedKeys(defined) {
+		if _, ok := structs.RootTypes[name]; !ok && name != openGraphDefaultLayout {
+			return nil, fmt.Errorf("OpenGraph layout %q: unknown type, expected one of %s or %q", name, strings.Join(sortedKeys(structs.RootTypes), ", "), openGraphDefaultLayout)
+		}
+
+		layout, err := newOpenGraphLayout(defined[name])
+		if err != nil {
+			return nil, fmt.Errorf("OpenGraph layout %q: %w", name, err)
+		}
+
+		if layout.logo != "" {
+			if logo == nil {
+				logo, logoHash, err = readOpenGraphLogo(staticDir, config.OpenGraph.Logo)
+				if err != nil {
+					return nil, err
+				}
+			}
+			layout.logoImage = logo
+			layout.hash += "+" + logoHash
+		}
+
+		layouts[name] = layout
+	}
+
+	return layouts, nil
+}
+
+func newOpenGraphLayout(config structs.OpenGraphLayout) (openGraphLayout, error) {
+	if config.Background == "" {
+		config.Background = openGraphLayoutDefaults.Background
+	}
+	if config.Accent == "" {
+		config.Accent = openGraphLayoutDefaults.Accent
+	}
+	if config.Text == "" {
+		config.Text = openGraphLayoutDefaults.Text
+	}
+	if config.Logo != "" && !openGraphLogoCorners[config.Logo] {
+		return openGraphLayout{}, fmt.Errorf("unknown logo position %q, expected one of %s", config.Logo, strings.Join(sortedKeys(openGraphLogoCorners), ", "))
+	}
+	for _, field := range config.Fields {
+		for _, name := range splitFieldRange(field) {
+			if name != "subtitle" && columnTitle(name) == "" {
+				return openGraphLayout{}, fmt.Errorf("unknown field %q", name)
+			}
+		}
+	}
+
+	layout := openGraphLayout{
+		fields: config.Fields,
+		logo:   config.Logo,
+	}
+
+	var err error
+	if layout.background, err = parseHexColor(config.Background); err != nil {
+		return openGraphLayout{}, fmt.Errorf("background: %w", err)
+	}
+	if layout.accent, err = parseHexColor(config.Accent); err != nil {
+		return openGraphLayout{}, fmt.Errorf("accent: %w", err)
+	}
+	if layout.text, err = parseHexColor(config.Text); err != nil {
+		return openGraphLayout{}, fmt.Errorf("text: %w", err)
+	}
+	layout.muted = mixColors(layout.text, layout.background, 1, 3)
+
+	b, err := json.Marshal(config)
+	if err != nil {
+		return openGraphLayout{}, fmt.Errorf("marshaling layout: %w", err)
+	}
+	layout.hash = string(b)
+
+	return layout, nil
+}
+
+// For returns the layout of the content's type.
+func (l openGraphLayouts) For(content structs.Content) openGraphLayout {
+	if layout, ok := l[pathType(content.Source)]; ok {
+		return layout
+	}
+	return l[openGraphDefaultLayout]
+}
+
+// subtitle returns the text shown under the title: the configured fields joined with a dot,
+// or the content's subtitle if the layout has no fields.
+func (l openGraphLayout) subtitle(content structs.Content) string {
+	if len(l.fields) == 0 {
+		return content.Subtitle
+	}
+
+	columns := content.Columns()
+	value := func(name string) string {
+		if name == "subtitle" {
+			return content.Subtitle
+		}
+		return columns[columnTitle(name)]
+	}
+
+	var parts []string
+	for _, field := range l.fields {
+		names := splitFieldRange(field)
+		if len(names) == 1 {
+			if v := value(names[0]); v != "" {
+				parts = append(parts, v)
+			}
+			continue
+		}
+
+		from, to := value(names[0]), value(names[1])
+		if from != "" || to != "" {
+			parts = append(parts, from+"–"+to)
+		}
+	}
+	return strings.Join(parts, " · ")
+}
+
+// splitFieldRange splits "dob-dod" into ["dob", "dod"].
+func splitFieldRange(field string) []string {
+	if from, to, ok := strings.Cut(field, "-"); ok {
+		return []string{strings.TrimSpace(from), strings.TrimSpace(to)}
+	}
+	return []string{strings.TrimSpace(field)}
+}
+
+// columnTitle returns the title of a column by its name as used in the schema,
+// e.g. "Born" for "dob".
+func columnTitle(name string) string {
+	for _, column := range structs.ColumnsList {
+		if column.Name == name {
+			return column.Title
+		}
+	}
+	return ""
+}
+
+func readOpenGraphLogo(staticDir, path string) (image.Image, string, error) {
+	if path == "" {
+		path = "logo.png"
+	}
+
+	b, err := os.ReadFile(filepath.Join(staticDir, path))
+	if err != nil {
+		return nil, "", fmt.Errorf("reading OpenGraph logo: %w", err)
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		return nil, "", fmt.Errorf("decoding OpenGraph logo %q: %w", path, err)
+	}
+	return img, fmt.Sprintf("%x", crc32.ChecksumIEEE(b)), nil
+}
+
+// logoRect returns where the logo goes: in its corner, outside of the area between the rules.
+func (l openGraphLayout) logoRect(width, height int) image.Rectangle {
+	if l.logoImage == nil || l.logo == "" {
+		return image.Rectangle{}
+	}
+
+	margin := width / 16
+	top := height / 18
+	logoHeight := height / 12
+	bounds := l.logoImage.Bounds()
+	logoWidth := logoHeight * bounds.Dx() / max(bounds.Dy(), 1)
+
+	vertical, horizontal, _ := strings.Cut(l.logo, "-")
+	y := top + (height/5-top-logoHeight)/2
+	if vertical == "bottom" {
+		y = height - height/5 + 6 + (height/5-6-logoHeight)/2
+	}
+	x := margin
+	if horizontal == "right" {
+		x = width - margin - logoWidth
+	}
+	return image.Rect(x, y, x+logoWidth, y+logoHeight)
+}
+
+func openGraphTemplateHash(layout openGraphLayout) string {
+	sum := sha256.Sum256([]byte(openGraphTemplateVersion + "\n" + layout.hash))
+	return hex.EncodeToString(sum[:])
+}
+
+// parseHexColor parses "#rgb" and "#rrggbb" colours.
+func parseHexColor(s string) (color.RGBA, error) {
+	hexDigits, ok := strings.CutPrefix(s, "#")
+	if ok && len(hexDigits) == 3 {
+		hexDigits = strings.Repeat(hexDigits[:1], 2) + strings.Repeat(hexDigits[1:2], 2) + strings.Repeat(hexDigits[2:], 2)
+	}
+	if !ok || len(hexDigits) != 6 {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q, expected #rrggbb", s)
+	}
+
+	v, err := strconv.ParseUint(hexDigits, 16, 32)
+	if err != nil {
+		return color.RGBA{}, fmt.Errorf("invalid colour %q, expected #rrggbb", s)
+	}
+	return color.RGBA{R: uint8(v >> 16), G: uint8(v >> 8), B: uint8(v), A: 255}, nil
+}
+
+// mixColors returns a colour n/d of the way from a to b.
+func mixColors(a, b color.RGBA, n, d int) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(int(x) + (int(y)-int(x))*n/d)
+	}
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: 255}
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/draw"
+	_ "image/gif"  // register GIF decoder for media files
+	_ "image/jpeg" // register JPEG decoder for media files
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/alsosee/finder/structs"
+)
+
+// openGraphPicture is a content's poster or portrait drawn on its OpenGraph image.
+// Full images are only decoded when the card is drawn (see decoded), thumbnails are cropped from a decoded sprite.
+type openGraphPicture struct {
+	img  image.Image
+	path string          // full image to decode, if img is nil
+	rect image.Rectangle // part of img to draw
+	hash string          // changes when the picture changes
+}
+
+// decoded returns the picture with its image decoded. The receiver is left as is,
+// so that the decoded image is dropped once the card is drawn.
+func (p *openGraphPicture) decoded() (*openGraphPicture, error) {
+	if p == nil || p.img != nil {
+		return p, nil
+	}
+
+	f, err := os.Open(p.path)
+	if err != nil {
+		return nil, fmt.Errorf("opening image: %w", err)
+	}
+	defer f.Close()
+
+	img, _, err := image.Decode(f)
+	if err != nil {
+		return nil, fmt.Errorf("decoding image %s: %w", p.path, err)
+	}
+	return &openGraphPicture{img: img, rect: img.Bounds(), hash: p.hash}, nil
+}
+
+func (p *openGraphPicture) portrait() bool {
+	return p.rect.Dy() > p.rect.Dx()
+}
+
+// openGraphPictures finds pictures in the media directory.
+// Decoded sprites are cached, as many contents share the same sprite.
+type openGraphPictures struct {
+	mediaDir string
+
+	mu      sync.Mutex
+	sprites map[string]image.Image
+}
+
+func newOpenGraphPictures(mediaDir string) *openGraphPictures {
+	return &openGraphPictures{mediaDir: mediaDir, sprites: map[string]image.Image{}}
+}
+
+// Picture returns the picture for a content: the full image from the media directory if it exists
+// and can be decoded, otherwise its thumbnail cropped from the sprite. It returns nil if there is neither.
+func (p *openGraphPictures) Picture(content structs.Content) (*openGraphPicture, error) {
+	if p == nil || p.mediaDir == "" || content.Image == nil {
+		return nil, nil
+	}
+	dir := filepath.Join(p.mediaDir, filepath.Dir(content.SourceNoExtention))
+
+	if content.Image.Path != "" {
+		picture, err := imagePicture(filepath.Join(dir, content.Image.Path))
+		if err != nil || picture != nil {
+			return picture, err
+		}
+		// missing or unsupported format (e.g. WebP), try the thumbnail
+	}
+
+	if content.Image.ThumbPath == "" || content.Image.ThumbWidth == 0 || content.Image.ThumbHeight == 0 {
+		return nil, nil
+	}
+	sprite, err := p.sprite(filepath.Join(dir, content.Image.ThumbPath))
+	if err != nil || sprite == nil {
+		return nil, err
+	}
+
+	rect := image.Rect(
+		content.Image.ThumbXOffset,
+		content.Image.ThumbYOffset,
+		content.Image.ThumbXOffset+content.Image.ThumbWidth,
+		content.Image.ThumbYOffset+content.Image.ThumbHeight,
+	).Add(sprite.Bounds().Min).Intersect(sprite.Bounds())
+	if rect.Empty() {
+		return nil, nil
+	}
+
+	return &openGraphPicture{img: sprite, rect: rect, hash: pixelsHash(sprite, rect)}, nil
+}
+
+// imagePicture returns the picture of a full image, reading only its header and hashing its bytes.
+// It returns nil if the image doesn't exist or its format is not supported.
+func imagePicture(path string) (*openGraphPicture, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("opening image: %w", err)
+	}
+	defer f.Close()
+
+	config, _, err := image.DecodeConfig(f)
+	if err != nil {
+		return nil, nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+	hash := crc32.NewIEEE()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, fmt.Errorf("reading image: %w", err)
+	}
+
+	return &openGraphPicture{
+		path: path,
+		rect: image.Rect(0, 0, config.Width, config.Height),
+		hash: fmt.Sprintf("%x", hash.Sum32()),
+	}, nil
+}
+
+func (p *openGraphPictures) sprite(path string) (image.Image, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if sprite, ok := p.sprites[path]; ok {
+		return sprite, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("reading sprite: %w", err)
+	}
+
+	var sprite image.Image
+	if err == nil {
+		sprite, _, _ = image.Decode(bytes.NewReader(data)) // not decodable is the same as missing
+	}
+	p.sprites[path] = sprite
+	return sprite, nil
+}
+
+// pixelsHash hashes pixels of a part of an image,
+// so that changes to other thumbnails in the same sprite don't affect it.
+func pixelsHash(img image.Image, rect image.Rectangle) string {
+	hash := crc32.NewIEEE()
+	buf := make([]byte, 0, rect.Dx()*4)
+	for y := rect.Min.Y; y < rect.Max.Y; y++ {
+		buf = buf[:0]
+		for x := rect.Min.X; x < rect.Max.X; x++ {
+			c := color.NRGBAModel.Convert(img.At(x, y)).(color.NRGBA)
+			buf = append(buf, c.R, c.G, c.B, c.A)
+		}
+		_, _ = hash.Write(buf)
+	}
+	return fmt.Sprintf("%x", hash.Sum32())
+}
+
+// coverRect returns the largest centered part of rect with the aspect ratio of target.
+func coverRect(rect, target image.Rectangle) image.Rectangle {
+	if rect.Empty() || target.Empty() {
+		return rect
+	}
+
+	w, h := rect.Dx(), rect.Dy()
+	if w*target.Dy() > h*target.Dx() {
+		// too wide
+		w = h * target.Dx() / target.Dy()
+	} else {
+		h = w * target.Dy() / target.Dx()
+	}
+	minX := rect.Min.X + (rect.Dx()-w)/2
+	minY := rect.Min.Y + (rect.Dy()-h)/2
+	return image.Rect(minX, minY, minX+w, minY+h)
+}
+
+// fitRect returns the largest rect with the aspect ratio of src that fits in box,
+// aligned to the right and centered vertically.
+func fitRect(src, box image.Rectangle) image.Rectangle {
+	w, h := box.Dx(), box.Dy()
+	if src.Dx()*h > src.Dy()*w {
+		h = w * src.Dy() / src.Dx()
+	} else {
+		w = h * src.Dx() / src.Dy()
+	}
+	minY := box.Min.Y + (box.Dy()-h)/2
+	return image.Rect(box.Max.X-w, minY, box.Max.X, minY+h)
+}
+
+// drawScaled draws the sr part of src scaled to dr, averaging source pixels
+// when scaling down and sampling the nearest one when scaling up.
+func drawScaled(dst *image.RGBA, dr image.Rectangle, src image.Image, sr image.Rectangle) {
+	if dr.Empty() || sr.Empty() {
+		return
+	}
+
+	for y := dr.Min.Y; y < dr.Max.Y; y++ {
+		sy0 := sr.Min.Y + (y-dr.Min.Y)*sr.Dy()/dr.Dy()
+		sy1 := max(sr.Min.Y+(y-dr.Min.Y+1)*sr.Dy()/dr.Dy(), sy0+1)
+		for x := dr.Min.X; x < dr.Max.X; x++ {
+			sx0 := sr.Min.X + (x-dr.Min.X)*sr.Dx()/dr.Dx()
+			sx1 := max(sr.Min.X+(x-dr.Min.X+1)*sr.Dx()/dr.Dx(), sx0+1)
+
+			var r, g, b, a, n uint32
+			for sy := sy0; sy < sy1; sy++ {
+				for sx := sx0; sx < sx1; sx++ {
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r, g, b, a = r+cr, g+cg, b+cb, a+ca
+					n++
+				}
+			}
+			dst.Set(x, y, color.RGBA64{
+				R: uint16(r / n),
+				G: uint16(g / n),
+				B: uint16(b / n),
+				A: uint16(a / n),
+			})
+		}
+	}
+}
+
+// openGraphMaxMosaic is the number of thumbnails shown on a directory image.
+const openGraphMaxMosaic = 6
+
+// drawMosaic draws up to openGraphMaxMosaic pictures in a grid of up to 3×2 cells covering dr.
+func drawMosaic(dst *image.RGBA, dr image.Rectangle, pictures []*openGraphPicture, gap int) {
+	pictures = pictures[:min(len(pictures), openGraphMaxMosaic)]
+	columns, rows := 1, 1
+	switch {
+	case len(pictures) > 4:
+		columns, rows = 3, 2
+	case len(pictures) > 2:
+		columns, rows = 2, 2
+	case len(pictures) == 2:
+		columns = 2
+	}
+
+	for i, picture := range pictures {
+		column, row := i%columns, i/columns
+		cell := image.Rect(
+			dr.Min.X+dr.Dx()*column/columns,
+			dr.Min.Y+dr.Dy()*row/rows,
+			dr.Min.X+dr.Dx()*(column+1)/columns,
+			dr.Min.Y+dr.Dy()*(row+1)/rows,
+		)
+		// gaps between cells only, the mosaic is flush with the card edges
+		if column > 0 {
+			cell.Min.X += gap / 2
+		}
+		if column < columns-1 {
+			cell.Max.X -= gap - gap/2
+		}
+		if row > 0 {
+			cell.Min.Y += gap / 2
+		}
+		if row < rows-1 {
+			cell.Max.Y -= gap - gap/2
+		}
+		drawPicture(dst, cell, picture)
+	}
+}
+
+// drawPicture draws the picture over the background, scaled to cover dr.
+func drawPicture(dst *image.RGBA, dr image.Rectangle, picture *openGraphPicture) {
+	layer := image.NewRGBA(dr)
+	drawScaled(layer, dr, picture.img, coverRect(picture.rect, dr))
+	draw.Draw(dst, dr, layer, dr.Min, draw.Over)
+}
@@ -1,7 +1,17 @@
 package main
 
 import (
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"unicode"
 
 	"github.com/alsosee/finder/structs"
 )
@@ -37,11 +47,496 @@ func TestRenderOpenGraphImage(t *testing.T) {
 	}
 	content.GenerateID()
 
-	b, err := renderOpenGraphImage(content, 1200, 630)
+	layout, err := newOpenGraphLayout(structs.OpenGraphLayout{})
 	if err != nil {
-		t.Fatalf("renderOpenGraphImage() error = %v", err)
+		t.Fatalf("newOpenGraphLayout() error = %v", err)
+	}
+
+	b, err := renderOpenGraphCard(contentCard(content, layout), 1200, 630)
+	if err != nil {
+		t.Fatalf("renderOpenGraphCard() error = %v", err)
 	}
 	if len(b) == 0 {
-		t.Fatalf("renderOpenGraphImage() returned empty image")
+		t.Fatalf("renderOpenGraphCard() returned empty image")
+	}
+}
+
+func TestOpenGraphFontCoversLatinAndCyrillic(t *testing.T) {
+	fallback := glyphFor(fontFallback)
+
+	var runes []rune
+	for r := 'A'; r <= 'Z'; r++ {
+		runes = append(runes, r, unicode.ToLower(r))
+	}
+	for r := 'А'; r <= 'я'; r++ {
+		runes = append(runes, r)
+	}
+	for r := rune(0xC0); r <= 0x17F; r++ {
+		if unicode.IsLetter(r) {
+			runes = append(runes, r)
+		}
+	}
+	runes = append(runes, []rune("ЁёЄєІіЇїҐґЎў0123456789.,:;!?'\"«»„“”‘’()-–—…&/№")...)
+
+	for _, r := range runes {
+		glyph := glyphFor(r)
+		if r != fontFallback && reflect.DeepEqual(glyph, fallback) {
+			t.Errorf("no glyph for %q (%U)", r, r)
+		}
+		if len(glyph) != fontRows {
+			t.Errorf("glyph for %q has %d rows, want %d", r, len(glyph), fontRows)
+		}
+	}
+
+	for r, glyph := range fontGlyphs {
+		if len(glyph) > fontRows-fontAboveRows {
+			t.Errorf("glyph for %q has %d rows", r, len(glyph))
+		}
+		for _, row := range glyph {
+			if len(row) != len(glyph[0]) {
+				t.Errorf("glyph for %q has rows of different width", r)
+				break
+			}
+		}
+	}
+}
+
+func TestWrapAndTruncateText(t *testing.T) {
+	width := textWidth("Dune Part", 1)
+	lines := wrapText("Dune Part Two Supercalifragilistic", width, 1)
+	if len(lines) < 3 || lines[0] != "Dune Part" || lines[1] != "Two" {
+		t.Fatalf("wrapText() = %q, want it to start with %q", lines, []string{"Dune Part", "Two"})
+	}
+	for _, line := range lines {
+		if textWidth(line, 1) > width {
+			t.Errorf("line %q is wider than %d", line, width)
+		}
+	}
+
+	truncated := truncateLines(lines, 2, width, 1)
+	if len(truncated) != 2 || truncated[0] != "Dune Part" || !strings.HasSuffix(truncated[1], "…") {
+		t.Fatalf("truncateLines() = %q", truncated)
+	}
+	if got := truncateLines(lines[:1], 2, width, 1); !reflect.DeepEqual(got, lines[:1]) {
+		t.Fatalf("truncateLines() changed lines that fit: %q", got)
+	}
+
+	// a line narrower than a glyph gets one glyph per line
+	if got, want := wrapText("Dune Part", textWidth("D", 1)-1, 1), []string{"D", "u", "n", "e", "P", "a", "r", "t"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("wrapText() narrower than a glyph = %q, want %q", got, want)
+	}
+}
+
+func TestLayoutOpenGraphText(t *testing.T) {
+	short := layoutOpenGraphText("Heat", "1995", 1050, 340)
+	if short.titleScale != openGraphMaxTitleScale || len(short.title) != 1 || len(short.subtitle) != 1 {
+		t.Fatalf("short title layout = %+v", short)
+	}
+
+	long := layoutOpenGraphText(strings.Repeat("Very long title ", 40), "", 1050, 340)
+	if long.titleScale != openGraphMinTitleScale || long.height() > 340 {
+		t.Fatalf("long title layout = %+v", long)
+	}
+	if last := long.title[len(long.title)-1]; !strings.HasSuffix(last, "…") {
+		t.Fatalf("long title is not truncated with an ellipsis: %q", long.title)
+	}
+}
+
+func TestOpenGraphPictures(t *testing.T) {
+	mediaDir := t.TempDir()
+	writePNG := func(path string, width, height int, c color.Color) {
+		t.Helper()
+		img := image.NewRGBA(image.Rect(0, 0, width, height))
+		draw.Draw(img, img.Bounds(), &image.Uniform{C: c}, image.Point{}, draw.Src)
+		b, err := encodePNG(img)
+		if err != nil {
+			t.Fatalf("encodePNG() error = %v", err)
+		}
+		mustWriteFile(t, path, string(b))
+	}
+
+	writePNG(filepath.Join(mediaDir, "Movies", "Heat.png"), 40, 60, color.Black)
+	writePNG(filepath.Join(mediaDir, "Movies", "_thumbs.png"), 30, 10, color.White)
+
+	content := structs.Content{
+		SourceNoExtention: "Movies/Heat",
+		Image: &structs.Media{
+			Path:         "Heat.png",
+			ThumbPath:    "_thumbs.png",
+			ThumbXOffset: 10,
+			ThumbWidth:   20,
+			ThumbHeight:  10,
+		},
+	}
+
+	pictures := newOpenGraphPictures(mediaDir)
+	full, err := pictures.Picture(content)
+	if err != nil || full == nil {
+		t.Fatalf("Picture() = %v, %v", full, err)
+	}
+	if full.rect != image.Rect(0, 0, 40, 60) || !full.portrait() {
+		t.Fatalf("Picture() used %v, want the full portrait image", full.rect)
+	}
+	if full.img != nil {
+		t.Fatal("Picture() decoded the full image, want it decoded only when drawn")
+	}
+
+	writePNG(filepath.Join(mediaDir, "Movies", "Heat.png"), 40, 60, color.White)
+	changed, err := pictures.Picture(content)
+	if err != nil || changed.hash == full.hash {
+		t.Fatalf("Picture() hash = %q after the image changed, was %q (err %v)", changed.hash, full.hash, err)
+	}
+
+	content.Image.Path = "Missing.png"
+	thumb, err := pictures.Picture(content)
+	if err != nil || thumb == nil {
+		t.Fatalf("Picture() without full image = %v, %v", thumb, err)
+	}
+	if thumb.rect != image.Rect(10, 0, 30, 10) || thumb.portrait() {
+		t.Fatalf("Picture() used %v, want the landscape thumbnail", thumb.rect)
+	}
+
+	content.Image = nil
+	if none, err := pictures.Picture(content); none != nil || err != nil {
+		t.Fatalf("Picture() without image = %v, %v", none, err)
+	}
+
+	layout, err := newOpenGraphLayout(structs.OpenGraphLayout{})
+	if err != nil {
+		t.Fatalf("newOpenGraphLayout() error = %v", err)
+	}
+	for _, picture := range []*openGraphPicture{full, thumb} {
+		card := contentCard(content, layout)
+		card.picture = picture
+		if _, err := renderOpenGraphCard(card, 1200, 630); err != nil {
+			t.Fatalf("renderOpenGraphCard() with picture %v error = %v", picture.rect, err)
+		}
+	}
+	if full.img != nil {
+		t.Fatal("renderOpenGraphCard() kept the decoded image")
+	}
+}
+
+func TestOpenGraphLayouts(t *testing.T) {
+	staticDir := t.TempDir()
+	logo := image.NewRGBA(image.Rect(0, 0, 20, 10))
+	b, err := encodePNG(logo)
+	if err != nil {
+		t.Fatalf("encodePNG() error = %v", err)
+	}
+	mustWriteFile(t, filepath.Join(staticDir, "logo.png"), string(b))
+
+	var config structs.Config
+	config.OpenGraph.Layouts = map[string]structs.OpenGraphLayout{
+		"Movies": {Background: "#123", Fields: []string{"released", "directors"}, Logo: "top-right"},
+		"People": {Fields: []string{"dob-dod", "subtitle"}},
+	}
+	layouts, err := loadOpenGraphLayouts(config, staticDir)
+	if err != nil {
+		t.Fatalf("loadOpenGraphLayouts() error = %v", err)
+	}
+
+	movie := structs.Content{Source: "Movies/Heat.yml", Subtitle: "Crime", Released: "1995", Directors: []string{"Michael Mann"}}
+	person := structs.Content{Source: "People/Al Pacino.yml", Subtitle: "Actor", DOB: "1940"}
+	book := structs.Content{Source: "Books/Dune.yml", Subtitle: "Novel"}
+
+	tests := []struct {
+		content structs.Content
+		want    string
+	}{
+		{movie, "1995 · Michael Mann"},
+		{person, "1940– · Actor"},
+		{book, "Novel"},
+	}
+	for _, tt := range tests {
+		if got := layouts.For(tt.content).subtitle(tt.content); got != tt.want {
+			t.Errorf("subtitle(%q) = %q, want %q", tt.content.Source, got, tt.want)
+		}
+	}
+	if got := layouts.For(movie).background; got != (color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 255}) {
+		t.Errorf("movie background = %v", got)
+	}
+	if layouts.For(movie).logoImage == nil || layouts.For(book).logoImage != nil {
+		t.Errorf("logo should only be loaded for layouts that show it")
+	}
+	if _, err := renderOpenGraphCard(contentCard(movie, layouts.For(movie)), 1200, 630); err != nil {
+		t.Fatalf("renderOpenGraphCard() with logo error = %v", err)
+	}
+
+	// changing a layout changes the template hash of that type only
+	config.OpenGraph.Layouts["People"] = structs.OpenGraphLayout{Fields: []string{"dob-dod"}}
+	changed, err := loadOpenGraphLayouts(config, staticDir)
+	if err != nil {
+		t.Fatalf("loadOpenGraphLayouts() error = %v", err)
+	}
+	for _, content := range []structs.Content{movie, person, book} {
+		before := openGraphTemplateHash(layouts.For(content))
+		after := openGraphTemplateHash(changed.For(content))
+		if (before != after) != (content.Source == person.Source) {
+			t.Errorf("template hash of %q changed = %v", content.Source, before != after)
+		}
+	}
+
+	for _, layout := range []structs.OpenGraphLayout{
+		{Background: "red"},
+		{Fields: []string{"budget"}},
+		{Logo: "center"},
+	} {
+		config.OpenGraph.Layouts = map[string]structs.OpenGraphLayout{"Movies": layout}
+		if _, err := loadOpenGraphLayouts(config, staticDir); err == nil {
+			t.Errorf("loadOpenGraphLayouts(%+v) expected error", layout)
+		}
+	}
+	config.OpenGraph.Layouts = map[string]structs.OpenGraphLayout{"Films": {}}
+	if _, err := loadOpenGraphLayouts(config, staticDir); err == nil {
+		t.Errorf("loadOpenGraphLayouts() with unknown type expected error")
+	}
+}
+
+func TestOpenGraphProjectorRendersDirectoriesAndMissingPages(t *testing.T) {
+	outputDir := t.TempDir()
+	mediaDir := t.TempDir()
+
+	sprite := image.NewRGBA(image.Rect(0, 0, 20, 30))
+	b, err := encodePNG(sprite)
+	if err != nil {
+		t.Fatalf("encodePNG() error = %v", err)
+	}
+	mustWriteFile(t, filepath.Join(mediaDir, "Movies", "_thumbs.png"), string(b))
+	thumb := &structs.Media{ThumbPath: "_thumbs.png", ThumbWidth: 20, ThumbHeight: 30}
+
+	graph := &BuildGraph{
+		Config: structs.Config{Title: "Also, see"},
+		Contents: structs.Contents{
+			"Movies/Heat":       {Source: "Movies/Heat.yml", SourceNoExtention: "Movies/Heat", Name: "Heat", Image: thumb},
+			"Movies/Collateral": {Source: "Movies/Collateral.yml", Name: "Collateral"},
+		},
+		DirContents: map[string][]structs.File{
+			"":       {{Name: "Movies", IsFolder: true}},
+			"Movies": {{Name: "Collateral"}, {Name: "Heat", Image: thumb}},
+		},
+		Connections: structs.Connections{
+			"People/Michael Mann": {
+				"Movies/Heat":       {{To: "People/Michael Mann"}},
+				"Movies/Collateral": {{To: "People/Michael Mann"}},
+			},
+		},
+		MissingPages: []MissingPage{
+			{ID: "People/Michael Mann", Content: &structs.Content{Source: "People/Michael Mann.yml", Name: "Michael Mann"}},
+		},
+		Hashes: map[string]string{},
+	}
+
+	layouts, err := loadOpenGraphLayouts(graph.Config, "")
+	if err != nil {
+		t.Fatalf("loadOpenGraphLayouts() error = %v", err)
+	}
+	cards, err := openGraphCards(graph, layouts, newOpenGraphPictures(mediaDir))
+	if err != nil {
+		t.Fatalf("openGraphCards() error = %v", err)
+	}
+
+	type summary struct {
+		ID, Key, Title, Subtitle string
+		Pictures                 int
+	}
+	var got []summary
+	for _, card := range cards {
+		pictures := len(card.mosaic)
+		if card.picture != nil {
+			pictures++
+		}
+		got = append(got, summary{card.id, card.key, card.title, card.subtitle, pictures})
+	}
+	want := []summary{
+		{"Movies/Collateral", "opengraph/Movies/Collateral.png", "Collateral", "", 0},
+		{"Movies/Heat", "opengraph/Movies/Heat.png", "Heat", "", 1},
+		{"People/Michael Mann", "opengraph/People/Michael Mann.png", "Michael Mann", "referenced by 2 pages", 0},
+		{"/", "opengraph/index.png", "Also, see", "1 item", 0},
+		{"Movies/", "opengraph/Movies/index.png", "Movies", "2 items", 1},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("openGraphCards() =\n%+v\nwant\n%+v", got, want)
+	}
+
+	graph.Config.OpenGraphHost = "https://og.example"
+	graph.OpenGraphEnabled = true
+	projector := OpenGraphProjector{
+		outputDir: outputDir,
+		mediaDir:  mediaDir,
+		stateFile: filepath.Join(t.TempDir(), "state.json"),
+		host:      graph.Config.OpenGraphHost,
+	}
+	if err := projector.Run(graph); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+	for _, card := range want {
+		mustReadFile(t, filepath.Join(outputDir, card.Key))
+	}
+	if got := graph.OpenGraphIndexImage("Movies"); got != "https://og.example/opengraph/Movies/index.png" {
+		t.Fatalf("OpenGraphIndexImage() = %q", got)
+	}
+}
+
+type fakeOpenGraphUploader struct {
+	mu         sync.Mutex
+	uploaded   []string
+	deleted    []string
+	failUpload map[string]bool
+	failDelete map[string]bool
+	onUpload   func(n int) // called with the number of the upload
+}
+
+func (u *fakeOpenGraphUploader) Upload(key string, _ []byte, _ string) error {
+	u.mu.Lock()
+	u.uploaded = append(u.uploaded, key)
+	n := len(u.uploaded)
+	u.mu.Unlock()
+
+	if u.onUpload != nil {
+		u.onUpload(n)
+	}
+	if u.failUpload[key] {
+		return fmt.Errorf("access denied")
+	}
+	return nil
+}
+
+func (u *fakeOpenGraphUploader) Delete(key string) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.failDelete[key] {
+		return fmt.Errorf("access denied")
+	}
+	u.deleted = append(u.deleted, key)
+	return nil
+}
+
+func TestOpenGraphProjectorRemovesOrphanedImages(t *testing.T) {
+	outputDir := t.TempDir()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+	graph := &BuildGraph{
+		Contents: structs.Contents{
+			"Movies/Heat": {Source: "Movies/Heat.yml", Name: "Heat"},
+		},
+		Hashes: map[string]string{},
+	}
+
+	state := OpenGraphState{
+		"Movies/Removed": {Key: "opengraph/Movies/Removed.png", SourceHash: "a:b"},
+		"Movies/Locked":  {Key: "opengraph/Movies/Locked.png", SourceHash: "a:b"},
+		"Old/":           {Key: "opengraph/Old/index.png", SourceHash: "a:b"},
+		// renamed to Movies/Heat, whose card now has the key
+		"Movies/Heat (1995)": {Key: "opengraph/Movies/Heat.png", SourceHash: "a:b"},
+	}
+	if err := writeOpenGraphState(stateFile, state); err != nil {
+		t.Fatalf("writeOpenGraphState() error = %v", err)
+	}
+	for _, entry := range state {
+		mustWriteFile(t, filepath.Join(outputDir, entry.Key), "png")
+	}
+
+	uploader := &fakeOpenGraphUploader{failDelete: map[string]bool{"opengraph/Movies/Locked.png": true}}
+	projector := OpenGraphProjector{
+		outputDir: outputDir,
+		stateFile: stateFile,
+		host:      "https://og.example",
+		dryRun:    true,
+		uploader:  uploader,
+	}
+	if err := projector.Run(graph); err != nil {
+		t.Fatalf("Run() with dry run error = %v", err)
+	}
+	if len(uploader.deleted) != 0 || len(uploader.uploaded) != 0 {
+		t.Fatalf("dry run deleted %v and uploaded %v", uploader.deleted, uploader.uploaded)
+	}
+	mustReadFile(t, filepath.Join(outputDir, "opengraph/Movies/Removed.png"))
+	if got, err := readOpenGraphState(stateFile); err != nil || !reflect.DeepEqual(got, state) {
+		t.Fatalf("state after dry run = %v (err = %v), want it unchanged", got, err)
+	}
+
+	projector.dryRun = false
+	err := projector.Run(graph)
+	if err == nil || !strings.Contains(err.Error(), "1 of 4 orphaned OpenGraph images failed") {
+		t.Fatalf("Run() error = %v, want the locked image to fail", err)
+	}
+	if want := []string{"opengraph/Movies/Removed.png", "opengraph/Old/index.png"}; !reflect.DeepEqual(uploader.deleted, want) {
+		t.Fatalf("deleted %v, want %v", uploader.deleted, want)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "opengraph/Movies/Removed.png")); !os.IsNotExist(err) {
+		t.Fatalf("local orphaned image was not removed: %v", err)
+	}
+
+	got, err := readOpenGraphState(stateFile)
+	if err != nil {
+		t.Fatalf("readOpenGraphState() error = %v", err)
+	}
+	if want := []string{"Movies/Heat", "Movies/Locked"}; !reflect.DeepEqual(sortedKeys(got), want) {
+		t.Fatalf("state = %v, want %v", sortedKeys(got), want)
+	}
+}
+
+func TestOpenGraphProjectorGeneratesConcurrently(t *testing.T) {
+	const workers = 8
+	outputDir := t.TempDir()
+	stateFile := filepath.Join(t.TempDir(), "state.json")
+
+	graph := &BuildGraph{Contents: structs.Contents{}, Hashes: map[string]string{}}
+	graph.Config.OpenGraph.Width, graph.Config.OpenGraph.Height = 120, 63
+	for i := 0; i < 2*openGraphStateFlushEvery+50; i++ {
+		id := fmt.Sprintf("Movies/%03d", i)
+		graph.Contents[id] = structs.Content{Source: id + ".yml", Name: id}
+	}
+
+	// when the upload after two flushes starts, all but the images in progress are in the state file
+	var flushed int
+	uploader := &fakeOpenGraphUploader{
+		failUpload: map[string]bool{"opengraph/Movies/007.png": true},
+		onUpload: func(n int) {
+			if n == 2*openGraphStateFlushEvery+workers {
+				state, err := readOpenGraphState(stateFile)
+				if err != nil {
+					t.Errorf("readOpenGraphState() error = %v", err)
+				}
+				flushed = len(state)
+			}
+		},
+	}
+	projector := OpenGraphProjector{
+		outputDir: outputDir,
+		stateFile: stateFile,
+		host:      "https://og.example",
+		workers:   workers,
+		uploader:  uploader,
+		out:       newOutputWriter(),
+	}
+
+	err := projector.Run(graph)
+	if err == nil || !strings.Contains(err.Error(), "1 of 250 OpenGraph images failed") {
+		t.Fatalf("Run() error = %v, want one failed image", err)
+	}
+	if flushed < openGraphStateFlushEvery {
+		t.Fatalf("state had %d entries during the run, want it written every %d images", flushed, openGraphStateFlushEvery)
+	}
+
+	state, err := readOpenGraphState(stateFile)
+	if err != nil {
+		t.Fatalf("readOpenGraphState() error = %v", err)
+	}
+	if len(state) != len(graph.Contents)-1 {
+		t.Fatalf("state has %d entries, want %d", len(state), len(graph.Contents)-1)
+	}
+	if _, ok := state["Movies/007"]; ok {
+		t.Fatalf("state has an entry of the failed image")
+	}
+
+	// only the failed image is generated again
+	uploader.uploaded, uploader.failUpload, uploader.onUpload = nil, nil, nil
+	if err := projector.Run(graph); err != nil {
+		t.Fatalf("second Run() error = %v", err)
+	}
+	if want := []string{"opengraph/Movies/007.png"}; !reflect.DeepEqual(uploader.uploaded, want) {
+		t.Fatalf("second run uploaded %v, want %v", uploader.uploaded, want)
 	}
 }
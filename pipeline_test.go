@@ -73,6 +73,33 @@ character:
 	}
 }
 
+func TestSchemaMetadataValidateYAMLAcceptsBuiltinFields(t *testing.T) {
+	dir := t.TempDir()
+	mustWriteFile(t, filepath.Join(dir, "_finder", "schema.yml"), `
+content:
+  type: object
+  properties:
+    name:
+      type: string
+`)
+
+	meta, err := LoadSchemaMetadata(dir)
+	if err != nil {
+		t.Fatalf("LoadSchemaMetadata() error = %v", err)
+	}
+
+	content, diagnostics, err := NewParser(meta).ParseContentYAML("People/Leo Tolstoy.yml", []byte("name: Leo Tolstoy\naliases:\n  - Лев Толстой\n"))
+	if err != nil {
+		t.Fatalf("ParseContentYAML() error = %v", err)
+	}
+	if len(diagnostics) != 0 {
+		t.Fatalf("got diagnostics %#v, expected none", diagnostics)
+	}
+	if len(content.Aliases) != 1 || content.Aliases[0] != "Лев Толстой" {
+		t.Fatalf("got aliases %#v, expected [Лев Толстой]", content.Aliases)
+	}
+}
+
 func mustWriteFile(t *testing.T, path, content string) {
 	t.Helper()
 	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
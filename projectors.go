@@ -5,7 +5,6 @@ import (
 	"fmt"
 	"log"
 	"net/http"
-	"os"
 	"path/filepath"
 	"sort"
 	"strings"
@@ -15,48 +14,61 @@ import (
 	"github.com/meilisearch/meilisearch-go"
 )
 
-func buildProjectors(runtime Config, config structs.Config, outputs map[string]bool, openGraphHost string) []Projector {
+func buildProjectors(runtime Config, config structs.Config, outputs map[string]bool, openGraphHost string, clock buildClock) []Projector {
 	var projectors []Projector
 
 	if outputs["html"] {
-		projectors = append(projectors, NewHTMLProjector(
+		html := NewHTMLProjector(
 			config,
 			runtime.InfoDirectory,
 			runtime.StaticDirectory,
 			runtime.TemplatesDirectory,
 			runtime.OutputDirectory,
-		))
+			runtime.NumWorkers,
+		)
+		html.clock = clock
+		projectors = append(projectors, html)
 	}
 	if outputs["html"] || outputs["sitemap"] {
 		projectors = append(projectors, SitemapProjector{
 			infoDir:   runtime.InfoDirectory,
 			outputDir: runtime.OutputDirectory,
+			gzip:      runtime.SitemapGzip,
+			clock:     clock,
+			out:       newOutputWriter(),
 		})
 	}
-	if outputs["search"] && runtime.SearchMasterKey != "" {
+	if backend := buildSearchBackend(runtime); outputs["search"] && backend != nil {
 		projectors = append(projectors, SearchProjector{
 			stateFile: runtime.StateFile,
 			indexName: runtime.SearchIndexName,
 			force:     runtime.Force,
-			host:      runtime.SearchHost,
-			masterKey: runtime.SearchMasterKey,
-			timeout:   runtime.Timeout,
+			backend:   backend,
 		})
 	}
+	// the front end falls back to the static index when there is no search server
+	if outputs["static-search"] || (outputs["html"] && config.SearchHost == "") {
+		projectors = append(projectors, StaticSearchProjector{outputDir: runtime.OutputDirectory, out: newOutputWriter()})
+	}
 	if outputs["opengraph"] {
 		projectors = append(projectors, OpenGraphProjector{
 			outputDir: runtime.OutputDirectory,
+			mediaDir:  runtime.MediaDirectory,
+			staticDir: runtime.StaticDirectory,
 			stateFile: runtime.OpenGraphState,
 			force:     runtime.Force,
 			host:      openGraphHost,
+			dryRun:    runtime.DryRun,
+			workers:   runtime.NumWorkers,
 			uploader:  buildOpenGraphUploader(runtime),
+			out:       newOutputWriter(),
 		})
 	}
 	if outputs["json"] {
-		projectors = append(projectors, JSONProjector{outputDir: runtime.OutputDirectory})
+		projectors = append(projectors, JSONProjector{outputDir: runtime.OutputDirectory, out: newOutputWriter()})
 	}
 	if outputs["markdown"] {
-		projectors = append(projectors, MarkdownProjector{outputDir: runtime.OutputDirectory})
+		projectors = append(projectors, MarkdownProjector{outputDir: runtime.OutputDirectory, out: newOutputWriter()})
 	}
 	if outputs["worker-redirects"] {
 		projectors = append(projectors, WorkerRedirectsProjector{
@@ -68,18 +80,67 @@ func buildProjectors(runtime Config, config structs.Config, outputs map[string]b
 	return projectors
 }
 
+// buildSearchBackend returns the backend search documents are written to,
+// or nil if neither a search directory nor a master key is set.
+func buildSearchBackend(runtime Config) SearchBackend {
+	if runtime.SearchDirectory != "" {
+		return NewFileSearchBackend(runtime.SearchDirectory)
+	}
+	if runtime.SearchMasterKey == "" {
+		return nil
+	}
+
+	return NewMeilisearchBackend(runtime.SearchHost, meilisearch.New(
+		runtime.SearchHost,
+		meilisearch.WithAPIKey(runtime.SearchMasterKey),
+		meilisearch.WithCustomClient(&http.Client{
+			Timeout: runtime.Timeout,
+		}),
+	))
+}
+
 func buildOpenGraphUploader(runtime Config) OpenGraphUploader {
-	if runtime.OpenGraphR2Account == "" || runtime.OpenGraphR2KeyID == "" || runtime.OpenGraphR2Secret == "" || runtime.OpenGraphR2Bucket == "" {
+	hasEndpoint := runtime.OpenGraphEndpoint != "" || runtime.OpenGraphR2Account != ""
+	if !hasEndpoint || runtime.OpenGraphR2KeyID == "" || runtime.OpenGraphR2Secret == "" || runtime.OpenGraphR2Bucket == "" {
 		return NoopOpenGraphUploader{}
 	}
 
-	return R2OpenGraphUploader{
-		accountID:       runtime.OpenGraphR2Account,
-		accessKeyID:     runtime.OpenGraphR2KeyID,
-		accessKeySecret: runtime.OpenGraphR2Secret,
-		bucket:          runtime.OpenGraphR2Bucket,
-		client:          &http.Client{Timeout: runtime.Timeout},
+	client := newR2Client(
+		runtime.OpenGraphR2Account,
+		runtime.OpenGraphR2Bucket,
+		runtime.OpenGraphR2KeyID,
+		runtime.OpenGraphR2Secret,
+		&http.Client{Timeout: runtime.Timeout},
+	)
+	if runtime.OpenGraphEndpoint != "" {
+		client.endpoint = runtime.OpenGraphEndpoint
+		client.region = runtime.OpenGraphRegion
+		client.virtualHosted = runtime.OpenGraphVirtualHosted
 	}
+	return client
+}
+
+func buildDeployProjector(runtime Config) (DeployProjector, error) {
+	if runtime.DeployEndpoint == "" || runtime.DeployBucket == "" {
+		return DeployProjector{}, fmt.Errorf("deploy requires --deploy-endpoint and --deploy-bucket")
+	}
+
+	return DeployProjector{
+		outputDir: runtime.OutputDirectory,
+		store: S3Client{
+			endpoint:        runtime.DeployEndpoint,
+			region:          runtime.DeployRegion,
+			bucket:          runtime.DeployBucket,
+			accessKeyID:     runtime.DeployKeyID,
+			accessKeySecret: runtime.DeploySecret,
+			virtualHosted:   runtime.DeployVirtualHosted,
+			client:          &http.Client{Timeout: 5 * time.Minute},
+		},
+		prefix:  runtime.DeployPrefix,
+		delete:  runtime.DeployDelete,
+		dryRun:  runtime.DryRun,
+		workers: runtime.NumWorkers,
+	}, nil
 }
 
 func selectedOutputs(runtime Config) map[string]bool {
@@ -87,7 +148,7 @@ func selectedOutputs(runtime Config) map[string]bool {
 	if runtime.Outputs == "" {
 		outputs["html"] = true
 		outputs["sitemap"] = true
-		if runtime.SearchMasterKey != "" {
+		if runtime.SearchMasterKey != "" || runtime.SearchDirectory != "" {
 			outputs["search"] = true
 		}
 		return outputs
@@ -108,19 +169,25 @@ func onlyWorkerRedirects(outputs map[string]bool) bool {
 
 type JSONProjector struct {
 	outputDir string
+	out       *outputWriter
 }
 
 func (p JSONProjector) Name() string {
 	return "json"
 }
 
+func (p JSONProjector) Outputs() []OutputFile {
+	if p.out == nil {
+		return nil
+	}
+	return p.out.Outputs()
+}
+
 type SearchProjector struct {
 	stateFile string
 	indexName string
 	force     string
-	host      string
-	masterKey string
-	timeout   time.Duration
+	backend   SearchBackend
 }
 
 func (p SearchProjector) Name() string {
@@ -128,21 +195,12 @@ func (p SearchProjector) Name() string {
 }
 
 func (p SearchProjector) Run(graph *BuildGraph) error {
-	if p.masterKey == "" {
+	if p.backend == nil {
 		return nil
 	}
 
-	log.Printf("Current state contains %d entries", len(graph.Hashes))
-
-	client := meilisearch.New(
-		p.host,
-		meilisearch.WithAPIKey(p.masterKey),
-		meilisearch.WithCustomClient(&http.Client{
-			Timeout: p.timeout,
-		}),
-	)
-
-	indexer := NewIndexer(meiliSearchClient{client: client}, graph)
+	indexer := NewIndexer(p.backend, graph)
+	log.Printf("Current state contains %d entries", len(indexer.state))
 
 	return indexer.Index(
 		p.stateFile,
@@ -158,11 +216,12 @@ func (p JSONProjector) Run(graph *BuildGraph) error {
 		Directories map[string][]structs.File `json:"directories"`
 	}
 
-	outPath := filepath.Join(p.outputDir, "data", "graph.json")
-	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
-		return fmt.Errorf("creating json output dir: %w", err)
+	if p.out == nil {
+		p.out = newOutputWriter()
 	}
 
+	outPath := filepath.Join(p.outputDir, "data", "graph.json")
+
 	b, err := json.MarshalIndent(jsonGraph{
 		Contents:    graph.Contents,
 		Connections: graph.Connections,
@@ -172,23 +231,37 @@ func (p JSONProjector) Run(graph *BuildGraph) error {
 		return fmt.Errorf("marshaling graph json: %w", err)
 	}
 
-	return os.WriteFile(outPath, b, 0o644)
+	if _, err := p.out.WriteFile(outPath, b); err != nil {
+		return fmt.Errorf("writing graph json: %w", err)
+	}
+
+	return nil
 }
 
 type MarkdownProjector struct {
 	outputDir string
+	out       *outputWriter
 }
 
 func (p MarkdownProjector) Name() string {
 	return "markdown"
 }
 
+func (p MarkdownProjector) Outputs() []OutputFile {
+	if p.out == nil {
+		return nil
+	}
+	return p.out.Outputs()
+}
+
 func (p MarkdownProjector) Run(graph *BuildGraph) error {
-	for id, content := range graph.Contents {
+	if p.out == nil {
+		p.out = newOutputWriter()
+	}
+
+	for _, id := range sortedKeys(graph.Contents) {
+		content := graph.Contents[id]
 		outPath := filepath.Join(p.outputDir, "markdown", id+".md")
-		if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
-			return fmt.Errorf("creating markdown output dir: %w", err)
-		}
 
 		var b strings.Builder
 		title := content.Header()
@@ -220,7 +293,7 @@ func (p MarkdownProjector) Run(graph *BuildGraph) error {
 			}
 		}
 
-		if err := os.WriteFile(outPath, []byte(b.String()), 0o644); err != nil {
+		if _, err := p.out.WriteFile(outPath, []byte(b.String()), content.Source); err != nil {
 			return fmt.Errorf("writing markdown %q: %w", outPath, err)
 		}
 	}
@@ -19,13 +19,13 @@ func TestBuildProjectorsKeepsExplicitOrder(t *testing.T) {
 		OpenGraphState:     ".opengraph-state",
 	}
 
-	projectors := buildProjectors(runtime, structs.Config{}, map[string]bool{
+	projectors := buildProjectors(runtime, structs.Config{SearchHost: "https://search.example.test"}, map[string]bool{
 		"html":      true,
 		"search":    true,
 		"opengraph": true,
 		"json":      true,
 		"markdown":  true,
-	}, "https://images.example.test")
+	}, "https://images.example.test", buildClock{})
 
 	names := make([]string, 0, len(projectors))
 	for _, projector := range projectors {
@@ -49,14 +49,15 @@ func TestBuildProjectorsSkipsSearchWithoutMasterKey(t *testing.T) {
 	projectors := buildProjectors(runtime, structs.Config{}, map[string]bool{
 		"html":   true,
 		"search": true,
-	}, "")
+	}, "", buildClock{})
 
 	names := make([]string, 0, len(projectors))
 	for _, projector := range projectors {
 		names = append(names, projector.Name())
 	}
 
-	want := []string{"html", "sitemap"}
+	// without a search server, the front end uses the static search index
+	want := []string{"html", "sitemap", "static-search"}
 	if !reflect.DeepEqual(names, want) {
 		t.Fatalf("buildProjectors() names = %v, want %v", names, want)
 	}
@@ -65,7 +66,7 @@ func TestBuildProjectorsSkipsSearchWithoutMasterKey(t *testing.T) {
 func TestBuildProjectorsAllowsSitemapOnly(t *testing.T) {
 	projectors := buildProjectors(Config{OutputDirectory: "output"}, structs.Config{}, map[string]bool{
 		"sitemap": true,
-	}, "")
+	}, "", buildClock{})
 
 	names := make([]string, 0, len(projectors))
 	for _, projector := range projectors {
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// OutputProjector is a projector that writes files to the output directory.
+type OutputProjector interface {
+	Projector
+
+	// Outputs returns files written or kept up to date during the last run.
+	Outputs() []OutputFile
+}
+
+// outputScopes lists parts of the output directory owned by each projector,
+// as paths relative to the output directory (a trailing slash means a directory,
+// a trailing "*" means files in the same directory with names starting with the rest).
+// A file belongs to the projector with the longest matching scope.
+var outputScopes = map[string][]string{
+	"html":          {""},
+	"sitemap":       {"sitemap.xml", "sitemap_index.xml", "sitemap-*"},
+	"static-search": {"search/"},
+	"opengraph":     {"opengraph/"},
+	"json":          {"data/graph.json"},
+	"markdown":      {"markdown/"},
+}
+
+// outputPruner removes files from the output directory that were not produced
+// by any projector during the run, e.g. pages of deleted or renamed files.
+// Only files owned by projectors that ran are considered,
+// so a partial build (e.g. --outputs=json) doesn't remove other projectors' files.
+type outputPruner struct {
+	outputDir string
+	dryRun    bool
+	keep      []string // files never removed, e.g. state files stored in the output directory
+}
+
+// Prune removes stale files and returns their paths relative to the output directory.
+// In dry-run mode files are only listed.
+func (p outputPruner) Prune(projectors []Projector) ([]string, error) {
+	ran := map[string]bool{}
+	claimed := map[string]bool{}
+	for _, projector := range projectors {
+		ran[projector.Name()] = true
+		if op, ok := projector.(OutputProjector); ok {
+			for _, file := range op.Outputs() {
+				claimed[absPath(file.Path)] = true
+			}
+		}
+	}
+	for _, path := range p.keep {
+		if path != "" {
+			claimed[absPath(path)] = true
+		}
+	}
+
+	stale, err := p.staleFiles(ran, claimed)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, rel := range stale {
+		if p.dryRun {
+			log.Printf("Would remove %s", rel)
+			continue
+		}
+
+		path := filepath.Join(p.outputDir, rel)
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return nil, fmt.Errorf("removing %q: %w", path, err)
+		}
+		removeEmptyDirs(p.outputDir, filepath.Dir(path))
+	}
+
+	return stale, nil
+}
+
+func (p outputPruner) staleFiles(ran, claimed map[string]bool) ([]string, error) {
+	var stale []string
+
+	err := filepath.WalkDir(p.outputDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) && path == p.outputDir {
+				return filepath.SkipDir
+			}
+			return err
+		}
+		if d.IsDir() || claimed[absPath(path)] {
+			return nil
+		}
+
+		rel, err := filepath.Rel(p.outputDir, path)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if ran[outputOwner(rel)] {
+			stale = append(stale, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking output directory %q: %w", p.outputDir, err)
+	}
+
+	sort.Strings(stale)
+	return stale, nil
+}
+
+// outputOwner returns the name of the projector owning a path relative to the output directory.
+func outputOwner(rel string) string {
+	owner, longest := "", -1
+	for name, scopes := range outputScopes {
+		for _, scope := range scopes {
+			matches := rel == scope || (strings.HasSuffix(scope, "/") && strings.HasPrefix(rel, scope)) || scope == ""
+			if prefix, ok := strings.CutSuffix(scope, "*"); ok {
+				rest, found := strings.CutPrefix(rel, prefix)
+				matches = found && !strings.Contains(rest, "/")
+			}
+			if matches && len(scope) > longest {
+				owner, longest = name, len(scope)
+			}
+		}
+	}
+	return owner
+}
+
+// removeEmptyDirs removes dir and its parents up to (not including) root while they are empty.
+func removeEmptyDirs(root, dir string) {
+	root = filepath.Clean(root)
+	for dir = filepath.Clean(dir); dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)); dir = filepath.Dir(dir) {
+		if err := os.Remove(dir); err != nil {
+			// not empty (or already removed)
+			return
+		}
+	}
+}
+
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.Clean(path)
+	}
+	return abs
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+type fakeOutputProjector struct {
+	name    string
+	outputs []OutputFile
+}
+
+func (p fakeOutputProjector) Name() string            { return p.name }
+func (p fakeOutputProjector) Run(_ *BuildGraph) error { return nil }
+func (p fakeOutputProjector) Outputs() []OutputFile   { return p.outputs }
+
+func TestOutputPrunerRemovesUnclaimedFilesOfProjectorsThatRan(t *testing.T) {
+	outputDir := t.TempDir()
+	for _, file := range []string{
+		"index.html",
+		"Movies/Heat.html",
+		"Movies/Old/Removed.html",
+		"scripts.js",
+		".state",
+		"markdown/Movies/Old.md",
+		"opengraph/Movies/Heat.png",
+		"opengraph/Movies/Old.png",
+	} {
+		mustWriteFile(t, filepath.Join(outputDir, file), "")
+	}
+
+	projectors := []Projector{
+		fakeOutputProjector{name: "html", outputs: []OutputFile{
+			{Path: filepath.Join(outputDir, "index.html")},
+			{Path: filepath.Join(outputDir, "Movies", "Heat.html")},
+			{Path: filepath.Join(outputDir, "scripts.js")},
+		}},
+		fakeOutputProjector{name: "opengraph", outputs: []OutputFile{
+			{Path: filepath.Join(outputDir, "opengraph", "Movies", "Heat.png")},
+		}},
+	}
+	pruner := outputPruner{
+		outputDir: outputDir,
+		dryRun:    true,
+		keep:      []string{filepath.Join(outputDir, ".state")},
+	}
+
+	want := []string{"Movies/Old/Removed.html", "opengraph/Movies/Old.png"}
+
+	stale, err := pruner.Prune(projectors)
+	if err != nil {
+		t.Fatalf("Prune() dry run error = %v", err)
+	}
+	if !reflect.DeepEqual(stale, want) {
+		t.Fatalf("Prune() dry run = %v, want %v", stale, want)
+	}
+	if _, err := os.Stat(filepath.Join(outputDir, "Movies", "Old", "Removed.html")); err != nil {
+		t.Fatalf("dry run removed a file: %v", err)
+	}
+
+	pruner.dryRun = false
+	stale, err = pruner.Prune(projectors)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if !reflect.DeepEqual(stale, want) {
+		t.Fatalf("Prune() = %v, want %v", stale, want)
+	}
+
+	for _, removed := range []string{"Movies/Old/Removed.html", "Movies/Old", "opengraph/Movies/Old.png"} {
+		if _, err := os.Stat(filepath.Join(outputDir, removed)); !os.IsNotExist(err) {
+			t.Errorf("%s was not removed (err = %v)", removed, err)
+		}
+	}
+	for _, kept := range []string{"index.html", "Movies/Heat.html", ".state", "markdown/Movies/Old.md", "opengraph/Movies/Heat.png"} {
+		if _, err := os.Stat(filepath.Join(outputDir, kept)); err != nil {
+			t.Errorf("%s was removed: %v", kept, err)
+		}
+	}
+}
+
+func TestOutputOwner(t *testing.T) {
+	tests := map[string]string{
+		"index.html":              "html",
+		"sitemap.xml":             "sitemap",
+		"sitemap_index.xml":       "sitemap",
+		"sitemap-movies-2.xml.gz": "sitemap",
+		"sitemap-old/index.html":  "html",
+		"markdown/Movies/Heat.md": "markdown",
+		"markdownfile.html":       "html",
+		"opengraph/Heat.png":      "opengraph",
+		"data/graph.json":         "json",
+		"data/other.json":         "html",
+	}
+	for rel, want := range tests {
+		if got := outputOwner(rel); got != want {
+			t.Errorf("outputOwner(%q) = %q, want %q", rel, got, want)
+		}
+	}
+}
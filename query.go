@@ -0,0 +1,471 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+
+	"github.com/alsosee/finder/structs"
+)
+
+const queryCommandDescription = `Lists contents of the build graph that match a filter.
+
+A filter is a list of space-separated terms, all of which must match.
+Prefix a term with "-" to negate it. Values containing spaces can be quoted.
+
+  type:movie              content type (person, movie, book, ...)
+  path:Movies/2023        path prefix
+  has:directors           field is present and not empty ("has:image" checks for an image)
+  name:Heat               field equals value (case-insensitive, any item of a list)
+  name~heat               field contains value
+  released>=2023-01-01    field compares to value (numerically when both are numbers)
+  refs:Companies/Pixar    content references the path (outgoing connection)
+  refby:Movies/2023/Heat  content is referenced by the path (incoming connection)
+  incoming>10             number of pages referencing the content ("outgoing" for the opposite)
+
+Example: finder query type:movie path:Movies/2023 -has:directors`
+
+// QueryCommand lists contents of the build graph that match a filter expression.
+type QueryCommand struct {
+	Format string `long:"format" description:"output format: table, json or paths" default:"table"`
+	Fields string `long:"fields" description:"comma-separated fields to add to table and json output"`
+	Sort   string `long:"sort" description:"field to sort results by, prefix with \"-\" for descending order" default:"path"`
+	Limit  int    `long:"limit" description:"maximum number of results, 0 for no limit" default:"0"`
+
+	Args struct {
+		Filter []string `positional-arg-name:"filter"`
+	} `positional-args:"yes"`
+}
+
+// Run builds the graph from the runtime configuration and writes matching contents to w.
+func (q QueryCommand) Run(runtime Config, w io.Writer) error {
+	switch q.Format {
+	case "table", "json", "paths":
+	default:
+		return fmt.Errorf("unknown query output format %q", q.Format)
+	}
+
+	query, err := parseQuery(strings.Join(q.Args.Filter, " "))
+	if err != nil {
+		return fmt.Errorf("parsing query: %w", err)
+	}
+
+	graph, err := loadGraph(runtime, false)
+	if err != nil {
+		return err
+	}
+
+	evaluator := newQueryEvaluator(graph)
+	ids := evaluator.Select(query, q.Sort, q.Limit)
+
+	return writeQueryResults(w, evaluator, ids, q.Format, cleanPathList(strings.Split(q.Fields, ",")))
+}
+
+type queryTerm struct {
+	negate bool
+	key    string
+	op     string // one of ":", "~", ">", "<", ">=", "<="
+	value  string
+}
+
+type graphQuery []queryTerm
+
+func parseQuery(s string) (graphQuery, error) {
+	tokens, err := tokenizeQuery(s)
+	if err != nil {
+		return nil, err
+	}
+
+	query := make(graphQuery, 0, len(tokens))
+	for _, token := range tokens {
+		term, err := parseQueryTerm(token)
+		if err != nil {
+			return nil, err
+		}
+		query = append(query, term)
+	}
+
+	return query, nil
+}
+
+// tokenizeQuery splits a query into terms by whitespace,
+// keeping double-quoted parts together and removing the quotes.
+func tokenizeQuery(s string) ([]string, error) {
+	var (
+		tokens  []string
+		current strings.Builder
+		quoted  bool
+		started bool
+	)
+
+	for _, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			started = true
+		case unicode.IsSpace(r) && !quoted:
+			if started {
+				tokens = append(tokens, current.String())
+				current.Reset()
+				started = false
+			}
+		default:
+			current.WriteRune(r)
+			started = true
+		}
+	}
+
+	if quoted {
+		return nil, fmt.Errorf("unterminated quote in %q", s)
+	}
+	if started {
+		tokens = append(tokens, current.String())
+	}
+
+	return tokens, nil
+}
+
+func parseQueryTerm(token string) (queryTerm, error) {
+	term := queryTerm{}
+	if strings.HasPrefix(token, "-") {
+		term.negate = true
+		token = token[1:]
+	}
+
+	index := strings.IndexAny(token, ":~<>")
+	if index <= 0 {
+		return queryTerm{}, fmt.Errorf("invalid term %q: expected key, operator and value", token)
+	}
+
+	term.key = strings.ToLower(token[:index])
+	term.op = token[index : index+1]
+	rest := token[index+1:]
+	if (term.op == ">" || term.op == "<") && strings.HasPrefix(rest, "=") {
+		term.op += "="
+		rest = rest[1:]
+	}
+	term.value = rest
+
+	if term.key == "has" && term.op != ":" {
+		return queryTerm{}, fmt.Errorf("invalid term %q: \"has\" only supports \":\"", token)
+	}
+
+	return term, nil
+}
+
+// queryEvaluator matches graph contents against queries.
+// It lazily caches field values of each content, and is safe for concurrent use.
+type queryEvaluator struct {
+	graph    *BuildGraph
+	outgoing map[string][]string
+
+	mu     sync.Mutex // protects fields
+	fields map[string]map[string]interface{}
+}
+
+func newQueryEvaluator(graph *BuildGraph) *queryEvaluator {
+	outgoing := map[string][]string{}
+	for to, from := range graph.Connections {
+		for source := range from {
+			outgoing[source] = append(outgoing[source], to)
+		}
+	}
+	for source := range outgoing {
+		sort.Strings(outgoing[source])
+	}
+
+	return &queryEvaluator{
+		graph:    graph,
+		outgoing: outgoing,
+		fields:   map[string]map[string]interface{}{},
+	}
+}
+
+// Select returns IDs of contents matching the query,
+// sorted by the given field and truncated to limit (if limit is positive).
+func (e *queryEvaluator) Select(query graphQuery, sortBy string, limit int) []string {
+	var ids []string
+	for id := range e.graph.Contents {
+		if e.Match(id, query) {
+			ids = append(ids, id)
+		}
+	}
+
+	e.Sort(ids, sortBy)
+
+	if limit > 0 && len(ids) > limit {
+		ids = ids[:limit]
+	}
+
+	return ids
+}
+
+// Sort sorts IDs by the first value of a field,
+// in descending order if the field is prefixed with "-".
+func (e *queryEvaluator) Sort(ids []string, sortBy string) {
+	desc := strings.HasPrefix(sortBy, "-")
+	field := strings.ToLower(strings.TrimPrefix(sortBy, "-"))
+	if field == "" {
+		field = "path"
+	}
+
+	sort.SliceStable(ids, func(i, j int) bool {
+		a := firstValue(e.Values(ids[i], field))
+		b := firstValue(e.Values(ids[j], field))
+		if cmp := compareQueryValues(a, b); cmp != 0 {
+			if desc {
+				return cmp > 0
+			}
+			return cmp < 0
+		}
+		return ids[i] < ids[j]
+	})
+}
+
+func (e *queryEvaluator) Match(id string, query graphQuery) bool {
+	for _, term := range query {
+		if e.matchTerm(id, term) == term.negate {
+			return false
+		}
+	}
+	return true
+}
+
+func (e *queryEvaluator) matchTerm(id string, term queryTerm) bool {
+	if term.key == "has" {
+		return len(e.Values(id, strings.ToLower(term.value))) > 0
+	}
+
+	if term.key == "path" && term.op == ":" {
+		return id == term.value || strings.HasPrefix(id, strings.TrimSuffix(term.value, "/")+"/")
+	}
+
+	for _, value := range e.Values(id, term.key) {
+		switch term.op {
+		case ":":
+			if strings.EqualFold(value, term.value) {
+				return true
+			}
+		case "~":
+			if strings.Contains(strings.ToLower(value), strings.ToLower(term.value)) {
+				return true
+			}
+		case ">":
+			if compareQueryValues(value, term.value) > 0 {
+				return true
+			}
+		case "<":
+			if compareQueryValues(value, term.value) < 0 {
+				return true
+			}
+		case ">=":
+			if compareQueryValues(value, term.value) >= 0 {
+				return true
+			}
+		case "<=":
+			if compareQueryValues(value, term.value) <= 0 {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// Values returns non-empty values of a content field as strings.
+// Besides YAML fields it supports "path", "source", "dir", "type", "image",
+// "refs", "refby", "incoming" and "outgoing".
+func (e *queryEvaluator) Values(id, field string) []string {
+	content, ok := e.graph.Contents[id]
+	if !ok {
+		return nil
+	}
+
+	switch field {
+	case "path", "id":
+		return []string{id}
+	case "source":
+		return nonEmpty(content.Source)
+	case "dir":
+		dir := filepath.Dir(id)
+		if dir == "." {
+			dir = ""
+		}
+		return nonEmpty(dir)
+	case "type":
+		return nonEmpty(content.Type())
+	case "image":
+		image := content.Image
+		if image == nil {
+			image = e.graph.Media.ImageForPath(id)
+		}
+		if image == nil {
+			return nil
+		}
+		return nonEmpty(image.Path)
+	case "refs":
+		return e.outgoing[id]
+	case "refby":
+		return sortedKeys(e.graph.Connections[id])
+	case "incoming":
+		return []string{strconv.Itoa(len(e.graph.Connections[id]))}
+	case "outgoing":
+		return []string{strconv.Itoa(len(e.outgoing[id]))}
+	}
+
+	e.mu.Lock()
+	fields, ok := e.fields[id]
+	if !ok {
+		fields = contentFields(content)
+		e.fields[id] = fields
+	}
+	e.mu.Unlock()
+
+	return flattenQueryValue(fields[field])
+}
+
+// contentFields converts a content into a map keyed by YAML field names.
+func contentFields(content structs.Content) map[string]interface{} {
+	fields := map[string]interface{}{}
+
+	b, err := yaml.Marshal(content)
+	if err != nil {
+		return fields
+	}
+	if err := yaml.Unmarshal(b, &fields); err != nil {
+		return map[string]interface{}{}
+	}
+
+	return fields
+}
+
+func flattenQueryValue(value interface{}) []string {
+	switch v := value.(type) {
+	case nil:
+		return nil
+	case string:
+		return nonEmpty(v)
+	case []interface{}:
+		var result []string
+		for _, item := range v {
+			result = append(result, flattenQueryValue(item)...)
+		}
+		return result
+	case map[string]interface{}:
+		var result []string
+		for _, key := range sortedKeys(v) {
+			result = append(result, flattenQueryValue(v[key])...)
+		}
+		return result
+	default:
+		return nonEmpty(fmt.Sprint(v))
+	}
+}
+
+func nonEmpty(s string) []string {
+	if s == "" {
+		return nil
+	}
+	return []string{s}
+}
+
+func firstValue(values []string) string {
+	if len(values) == 0 {
+		return ""
+	}
+	return values[0]
+}
+
+// compareQueryValues compares two values numerically if both are numbers,
+// and lexicographically otherwise.
+func compareQueryValues(a, b string) int {
+	an, aErr := strconv.ParseFloat(a, 64)
+	bn, bErr := strconv.ParseFloat(b, 64)
+	if aErr == nil && bErr == nil {
+		switch {
+		case an < bn:
+			return -1
+		case an > bn:
+			return 1
+		default:
+			return 0
+		}
+	}
+
+	return strings.Compare(a, b)
+}
+
+type queryResult struct {
+	Path    string            `json:"path"`
+	Type    string            `json:"type"`
+	Name    string            `json:"name,omitempty"`
+	Fields  map[string]string `json:"fields,omitempty"`
+	Content structs.Content   `json:"content"`
+}
+
+func writeQueryResults(w io.Writer, e *queryEvaluator, ids []string, format string, fields []string) error {
+	switch format {
+	case "paths":
+		for _, id := range ids {
+			if _, err := fmt.Fprintln(w, e.graph.Contents[id].Source); err != nil {
+				return err
+			}
+		}
+		return nil
+
+	case "json":
+		results := make([]queryResult, 0, len(ids))
+		for _, id := range ids {
+			content := e.graph.Contents[id]
+			result := queryResult{
+				Path:    id,
+				Type:    content.Type(),
+				Name:    content.GetName(),
+				Content: content,
+			}
+			for _, field := range fields {
+				if result.Fields == nil {
+					result.Fields = map[string]string{}
+				}
+				result.Fields[field] = strings.Join(e.Values(id, strings.ToLower(field)), ", ")
+			}
+			results = append(results, result)
+		}
+
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(results)
+
+	default:
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		header := append([]string{"PATH", "TYPE", "NAME"}, fields...)
+		for i := 3; i < len(header); i++ {
+			header[i] = strings.ToUpper(header[i])
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+
+		for _, id := range ids {
+			content := e.graph.Contents[id]
+			row := []string{id, content.Type(), content.GetName()}
+			for _, field := range fields {
+				row = append(row, strings.Join(e.Values(id, strings.ToLower(field)), ", "))
+			}
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+		_, err := fmt.Fprintf(w, "%d result%s\n", len(ids), plural(len(ids)))
+		return err
+	}
+}
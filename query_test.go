@@ -0,0 +1,145 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/alsosee/finder/structs"
+)
+
+func TestParseQuery(t *testing.T) {
+	query, err := parseQuery(`type:movie -has:directors released>=2023 refs:"Companies/Warner Bros"`)
+	if err != nil {
+		t.Fatalf("parseQuery() error = %v", err)
+	}
+
+	want := graphQuery{
+		{key: "type", op: ":", value: "movie"},
+		{negate: true, key: "has", op: ":", value: "directors"},
+		{key: "released", op: ">=", value: "2023"},
+		{key: "refs", op: ":", value: "Companies/Warner Bros"},
+	}
+	if !reflect.DeepEqual(query, want) {
+		t.Fatalf("parseQuery() = %#v, want %#v", query, want)
+	}
+
+	for _, invalid := range []string{"movie", `name:"Heat`, "has>1"} {
+		if _, err := parseQuery(invalid); err == nil {
+			t.Errorf("parseQuery(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestQueryEvaluatorSelect(t *testing.T) {
+	evaluator := newQueryEvaluator(testQueryGraph())
+
+	tests := []struct {
+		query string
+		sort  string
+		want  []string
+	}{
+		{query: "type:movie path:Movies/2023 -has:directors", want: []string{"Movies/2023/Barbie"}},
+		{query: "type:person -has:image", want: []string{"People/Bob"}},
+		{query: "refs:Companies/Pixar", want: []string{"Movies/2023/Elemental"}},
+		{query: "refby:Movies/2023/Elemental", want: []string{"Companies/Pixar", "People/Alice"}},
+		{query: "name~EL", want: []string{"Movies/2023/Elemental"}},
+		{query: "incoming>=1", sort: "-incoming", want: []string{"People/Alice", "Companies/Pixar"}},
+		{query: "released<2023-06-01", want: []string{"Movies/2022/Heat"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			query, err := parseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parseQuery() error = %v", err)
+			}
+			got := evaluator.Select(query, tt.sort, 0)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("Select() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWriteQueryResultsPathsAndTable(t *testing.T) {
+	evaluator := newQueryEvaluator(testQueryGraph())
+	ids := []string{"Movies/2022/Heat", "Movies/2023/Elemental"}
+
+	var paths bytes.Buffer
+	if err := writeQueryResults(&paths, evaluator, ids, "paths", nil); err != nil {
+		t.Fatalf("writeQueryResults(paths) error = %v", err)
+	}
+	if got, want := paths.String(), "Movies/2022/Heat.yml\nMovies/2023/Elemental.yml\n"; got != want {
+		t.Fatalf("paths output = %q, want %q", got, want)
+	}
+
+	var table bytes.Buffer
+	if err := writeQueryResults(&table, evaluator, ids, "table", []string{"directors"}); err != nil {
+		t.Fatalf("writeQueryResults(table) error = %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(table.String()), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("table output = %q, expected header, two rows and a summary", table.String())
+	}
+	if !strings.HasPrefix(lines[0], "PATH") || !strings.Contains(lines[0], "DIRECTORS") {
+		t.Fatalf("table header = %q", lines[0])
+	}
+	if !strings.Contains(lines[2], "Alice") {
+		t.Fatalf("table row = %q, expected director", lines[2])
+	}
+}
+
+func testQueryGraph() *BuildGraph {
+	contents := structs.Contents{
+		"Movies/2022/Heat": {
+			Source:    "Movies/2022/Heat.yml",
+			Name:      "Heat",
+			Released:  "2022-12-01",
+			Directors: []string{"Alice"},
+		},
+		"Movies/2023/Barbie": {
+			Source:   "Movies/2023/Barbie.yml",
+			Name:     "Barbie",
+			Released: "2023-07-21",
+		},
+		"Movies/2023/Elemental": {
+			Source:     "Movies/2023/Elemental.yml",
+			Name:       "Elemental",
+			Released:   "2023-06-16",
+			Directors:  []string{"Alice"},
+			Production: []string{"Pixar"},
+		},
+		"People/Alice": {
+			Source: "People/Alice.yml",
+			Name:   "Alice",
+			Image:  &structs.Media{Path: "Alice.jpg"},
+		},
+		"People/Bob": {
+			Source: "People/Bob.yml",
+			Name:   "Bob",
+		},
+		"Companies/Pixar": {
+			Source: "Companies/Pixar.yml",
+			Name:   "Pixar",
+		},
+	}
+
+	connections := structs.Connections{}
+	for id, content := range contents {
+		content.GenerateID()
+		contents[id] = content
+		for _, conn := range content.Connections() {
+			if connections[conn.To] == nil {
+				connections[conn.To] = map[string][]structs.Connection{}
+			}
+			connections[conn.To][id] = append(connections[conn.To][id], conn)
+		}
+	}
+
+	return &BuildGraph{
+		Contents:    contents,
+		Connections: connections,
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// buildClock provides timestamps for generated output.
+//
+// In reproducible mode the system clock and file modification times are not used
+// directly: the build time comes from SOURCE_DATE_EPOCH
+// (see https://reproducible-builds.org/specs/source-date-epoch/),
+// and modification times are clamped to it, so two builds of the same commit
+// produce byte-identical output.
+//
+// The zero value uses the system clock and unmodified file modification times.
+type buildClock struct {
+	reproducible bool
+	epoch        time.Time // zero if SOURCE_DATE_EPOCH is not set
+}
+
+// newBuildClock returns a clock for the runtime configuration.
+// Setting SOURCE_DATE_EPOCH enables reproducible mode.
+func newBuildClock(runtime Config) (buildClock, error) {
+	clock := buildClock{reproducible: runtime.Reproducible}
+
+	value := strings.TrimSpace(runtime.SourceDateEpoch)
+	if value == "" {
+		return clock, nil
+	}
+
+	seconds, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || seconds < 0 {
+		return buildClock{}, fmt.Errorf("invalid SOURCE_DATE_EPOCH %q: expected a non-negative number of seconds", value)
+	}
+
+	clock.reproducible = true
+	clock.epoch = time.Unix(seconds, 0).UTC()
+	return clock, nil
+}
+
+// Now returns the build time.
+func (c buildClock) Now() time.Time {
+	if !c.reproducible {
+		return time.Now()
+	}
+	if c.epoch.IsZero() {
+		return time.Unix(0, 0).UTC()
+	}
+	return c.epoch
+}
+
+// ModTime returns a file modification time to use in generated output.
+// In reproducible mode it's clamped to SOURCE_DATE_EPOCH,
+// or dropped (zero time) if SOURCE_DATE_EPOCH is not set.
+func (c buildClock) ModTime(t time.Time) time.Time {
+	if !c.reproducible || t.IsZero() {
+		return t
+	}
+	if c.epoch.IsZero() {
+		return time.Time{}
+	}
+	if t.After(c.epoch) {
+		return c.epoch
+	}
+	return t
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/alsosee/finder/structs"
+)
+
+func TestBuildClockSourceDateEpoch(t *testing.T) {
+	clock, err := newBuildClock(Config{SourceDateEpoch: "1700000000"})
+	if err != nil {
+		t.Fatalf("newBuildClock() error = %v", err)
+	}
+
+	epoch := time.Unix(1700000000, 0).UTC()
+	if got := clock.Now(); !got.Equal(epoch) {
+		t.Fatalf("Now() = %v, want %v", got, epoch)
+	}
+
+	older := epoch.Add(-time.Hour)
+	if got := clock.ModTime(older); !got.Equal(older) {
+		t.Fatalf("ModTime(older) = %v, want %v", got, older)
+	}
+	if got := clock.ModTime(epoch.Add(time.Hour)); !got.Equal(epoch) {
+		t.Fatalf("ModTime(newer) = %v, want it clamped to %v", got, epoch)
+	}
+
+	for _, invalid := range []string{"yesterday", "-1"} {
+		if _, err := newBuildClock(Config{SourceDateEpoch: invalid}); err == nil {
+			t.Errorf("newBuildClock(%q) expected error", invalid)
+		}
+	}
+}
+
+func TestBuildClockReproducibleWithoutEpoch(t *testing.T) {
+	clock, err := newBuildClock(Config{Reproducible: true})
+	if err != nil {
+		t.Fatalf("newBuildClock() error = %v", err)
+	}
+
+	if got := clock.Now().Unix(); got != 0 {
+		t.Fatalf("Now() = %d, want 0", got)
+	}
+	if got := clock.ModTime(time.Now()); !got.IsZero() {
+		t.Fatalf("ModTime() = %v, want zero time", got)
+	}
+
+	var system buildClock
+	now := time.Now()
+	if got := system.ModTime(now); !got.Equal(now) {
+		t.Fatalf("zero buildClock ModTime() = %v, want %v", got, now)
+	}
+}
+
+func TestSitemapEntriesClampLastModToSourceDateEpoch(t *testing.T) {
+	infoDir := t.TempDir()
+	path := filepath.Join(infoDir, "Movies", "Heat.yml")
+	mustWriteFile(t, path, "name: Heat\n")
+	mustSetModTime(t, path, time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC))
+
+	clock, err := newBuildClock(Config{SourceDateEpoch: "1700000000"})
+	if err != nil {
+		t.Fatalf("newBuildClock() error = %v", err)
+	}
+
+	entries := sitemapEntries(&BuildGraph{
+		Config: structs.Config{URL: "https://alsosee.example"},
+		Contents: structs.Contents{
+			"Movies/Heat": {Source: "Movies/Heat.yml"},
+		},
+	}, infoDir, clock)
+
+	if len(entries) != 1 || entries[0].LastMod != "2023-11-14T22:13:20Z" {
+		t.Fatalf("sitemap entries = %#v, want lastmod clamped to SOURCE_DATE_EPOCH", entries)
+	}
+}
@@ -0,0 +1,555 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultS3Attempts           = 3
+	defaultS3RetryDelay         = time.Second
+	defaultS3MultipartThreshold = 64 << 20 // files larger than this are uploaded in parts
+	defaultS3PartSize           = 16 << 20 // S3 requires at least 5 MiB for all parts but the last
+)
+
+// S3Client talks to an S3-compatible object store (Cloudflare R2, MinIO, AWS S3).
+// Requests are retried with exponential backoff on network errors, 429 and 5xx responses.
+type S3Client struct {
+	endpoint        string // e.g. https://<account>.r2.cloudflarestorage.com or http://127.0.0.1:9000
+	region          string // "auto" for R2
+	bucket          string
+	accessKeyID     string
+	accessKeySecret string
+	virtualHosted   bool // use <bucket>.<host>/<key> instead of <host>/<bucket>/<key>
+	client          *http.Client
+	now             func() time.Time
+
+	attempts           int           // defaults to defaultS3Attempts
+	retryDelay         time.Duration // delay before the first retry, defaults to defaultS3RetryDelay
+	multipartThreshold int64         // defaults to defaultS3MultipartThreshold
+	partSize           int64         // defaults to defaultS3PartSize
+}
+
+// S3Object is an object returned by ListObjectsV2 or HEAD.
+type S3Object struct {
+	Key  string
+	ETag string // without quotes
+	Size int64
+}
+
+// s3StatusError is returned for non-2xx responses.
+type s3StatusError struct {
+	StatusCode int
+	Status     string
+	Body       string
+}
+
+func (e *s3StatusError) Error() string {
+	return fmt.Sprintf("status %s: %s", e.Status, e.Body)
+}
+
+// newR2Client returns a client for a Cloudflare R2 bucket.
+func newR2Client(accountID, bucket, accessKeyID, accessKeySecret string, client *http.Client) S3Client {
+	return S3Client{
+		endpoint:        fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID),
+		region:          "auto",
+		bucket:          bucket,
+		accessKeyID:     accessKeyID,
+		accessKeySecret: accessKeySecret,
+		client:          client,
+	}
+}
+
+// Upload implements OpenGraphUploader.
+func (c S3Client) Upload(key string, body []byte, contentType string) error {
+	return c.Put(key, body, contentType, "")
+}
+
+// Put uploads an object.
+func (c S3Client) Put(key string, body []byte, contentType, cacheControl string) error {
+	if int64(len(body)) > c.multipartThresholdOrDefault() {
+		return c.putMultipart(key, bytes.NewReader(body), int64(len(body)), contentType, cacheControl)
+	}
+
+	resp, err := c.do(http.MethodPut, key, nil, body, objectHeaders(contentType, cacheControl))
+	if err != nil {
+		return fmt.Errorf("uploading %q: %w", key, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// PutFile uploads a file, in parts if it is larger than the multipart threshold,
+// without reading it into memory at once.
+func (c S3Client) PutFile(key, file, contentType, cacheControl string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return fmt.Errorf("opening %q: %w", file, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("checking %q: %w", file, err)
+	}
+	if info.Size() > c.multipartThresholdOrDefault() {
+		return c.putMultipart(key, f, info.Size(), contentType, cacheControl)
+	}
+
+	body, err := io.ReadAll(f)
+	if err != nil {
+		return fmt.Errorf("reading %q: %w", file, err)
+	}
+	return c.Put(key, body, contentType, cacheControl)
+}
+
+// Head returns object metadata. The boolean is false if the object doesn't exist.
+func (c S3Client) Head(key string) (S3Object, bool, error) {
+	resp, err := c.do(http.MethodHead, key, nil, nil, nil)
+	var statusErr *s3StatusError
+	if errors.As(err, &statusErr) && statusErr.StatusCode == http.StatusNotFound {
+		return S3Object{}, false, nil
+	}
+	if err != nil {
+		return S3Object{}, false, fmt.Errorf("checking %q: %w", key, err)
+	}
+	_ = resp.Body.Close()
+
+	return S3Object{
+		Key:  key,
+		ETag: strings.Trim(resp.Header.Get("ETag"), `"`),
+		Size: resp.ContentLength,
+	}, true, nil
+}
+
+// Delete removes an object. Deleting a missing object is not an error.
+func (c S3Client) Delete(key string) error {
+	resp, err := c.do(http.MethodDelete, key, nil, nil, nil)
+	if err != nil {
+		return fmt.Errorf("deleting %q: %w", key, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+// List returns all objects with the given key prefix.
+func (c S3Client) List(prefix string) ([]S3Object, error) {
+	var objects []S3Object
+
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}}
+		if prefix != "" {
+			query.Set("prefix", prefix)
+		}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		resp, err := c.do(http.MethodGet, "", query, nil, nil)
+		if err != nil {
+			return nil, fmt.Errorf("listing objects: %w", err)
+		}
+
+		var result struct {
+			Contents []struct {
+				Key  string `xml:"Key"`
+				ETag string `xml:"ETag"`
+				Size int64  `xml:"Size"`
+			} `xml:"Contents"`
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&result)
+		_ = resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("decoding object list: %w", err)
+		}
+
+		for _, object := range result.Contents {
+			objects = append(objects, S3Object{
+				Key:  object.Key,
+				ETag: strings.Trim(object.ETag, `"`),
+				Size: object.Size,
+			})
+		}
+
+		if !result.IsTruncated || result.NextContinuationToken == "" {
+			return objects, nil
+		}
+		token = result.NextContinuationToken
+	}
+}
+
+// ContentETag returns the ETag the store assigns to the file's content when it's uploaded with PutFile:
+// the MD5 of the content, or, for multipart uploads, the MD5 of part MD5s followed by the number of parts.
+func (c S3Client) ContentETag(file string) (string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", fmt.Errorf("opening %q: %w", file, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	info, err := f.Stat()
+	if err != nil {
+		return "", fmt.Errorf("checking %q: %w", file, err)
+	}
+
+	if info.Size() <= c.multipartThresholdOrDefault() {
+		hash := md5.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return "", fmt.Errorf("reading %q: %w", file, err)
+		}
+		return hex.EncodeToString(hash.Sum(nil)), nil
+	}
+
+	partSize := c.partSizeOrDefault()
+	parts := 0
+	sums := md5.New()
+	for offset := int64(0); offset < info.Size(); offset += partSize {
+		hash := md5.New()
+		if _, err := io.Copy(hash, io.NewSectionReader(f, offset, partSize)); err != nil {
+			return "", fmt.Errorf("reading %q: %w", file, err)
+		}
+		sums.Write(hash.Sum(nil))
+		parts++
+	}
+	return fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), parts), nil
+}
+
+// putMultipart uploads size bytes from r in parts.
+// The upload is aborted if any part fails, so no incomplete parts are left in the bucket.
+func (c S3Client) putMultipart(key string, r io.ReaderAt, size int64, contentType, cacheControl string) error {
+	resp, err := c.do(http.MethodPost, key, url.Values{"uploads": {""}}, nil, objectHeaders(contentType, cacheControl))
+	if err != nil {
+		return fmt.Errorf("starting multipart upload of %q: %w", key, err)
+	}
+	var initiated struct {
+		UploadID string `xml:"UploadId"`
+	}
+	err = xml.NewDecoder(resp.Body).Decode(&initiated)
+	_ = resp.Body.Close()
+	if err != nil {
+		return fmt.Errorf("decoding multipart upload of %q: %w", key, err)
+	}
+
+	type completedPart struct {
+		PartNumber int    `xml:"PartNumber"`
+		ETag       string `xml:"ETag"`
+	}
+	var completed struct {
+		XMLName xml.Name        `xml:"CompleteMultipartUpload"`
+		Parts   []completedPart `xml:"Part"`
+	}
+
+	partSize := c.partSizeOrDefault()
+	for offset, number := int64(0), 1; offset < size; offset, number = offset+partSize, number+1 {
+		part := make([]byte, min(partSize, size-offset))
+		if _, err := r.ReadAt(part, offset); err != nil && !errors.Is(err, io.EOF) {
+			c.abortMultipart(key, initiated.UploadID)
+			return fmt.Errorf("reading part %d of %q: %w", number, key, err)
+		}
+
+		query := url.Values{"partNumber": {strconv.Itoa(number)}, "uploadId": {initiated.UploadID}}
+		resp, err := c.do(http.MethodPut, key, query, part, nil)
+		if err != nil {
+			c.abortMultipart(key, initiated.UploadID)
+			return fmt.Errorf("uploading part %d of %q: %w", number, key, err)
+		}
+		_ = resp.Body.Close()
+
+		completed.Parts = append(completed.Parts, completedPart{PartNumber: number, ETag: resp.Header.Get("ETag")})
+	}
+
+	body, err := xml.Marshal(completed)
+	if err != nil {
+		return fmt.Errorf("encoding parts of %q: %w", key, err)
+	}
+	resp, err = c.do(http.MethodPost, key, url.Values{"uploadId": {initiated.UploadID}}, body, nil)
+	if err != nil {
+		c.abortMultipart(key, initiated.UploadID)
+		return fmt.Errorf("completing multipart upload of %q: %w", key, err)
+	}
+	_ = resp.Body.Close()
+	return nil
+}
+
+func (c S3Client) abortMultipart(key, uploadID string) {
+	resp, err := c.do(http.MethodDelete, key, url.Values{"uploadId": {uploadID}}, nil, nil)
+	if err == nil {
+		_ = resp.Body.Close()
+	}
+}
+
+// do sends a signed request for an object key (empty for bucket-level requests),
+// retrying on network errors and retryable statuses. It returns the response if its status is 2xx.
+func (c S3Client) do(method, key string, query url.Values, body []byte, headers map[string]string) (*http.Response, error) {
+	attempts := c.attempts
+	if attempts < 1 {
+		attempts = defaultS3Attempts
+	}
+	delay := c.retryDelay
+	if delay == 0 {
+		delay = defaultS3RetryDelay
+	}
+
+	var err error
+	for attempt := 1; ; attempt++ {
+		var resp *http.Response
+		resp, err = c.doOnce(method, key, query, body, headers)
+		if err == nil {
+			return resp, nil
+		}
+		if attempt >= attempts || !retryableS3Error(err) {
+			return nil, err
+		}
+		time.Sleep(delay)
+		delay *= 2
+	}
+}
+
+func (c S3Client) doOnce(method, key string, query url.Values, body []byte, headers map[string]string) (*http.Response, error) {
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	now := time.Now().UTC()
+	if c.now != nil {
+		now = c.now().UTC()
+	}
+
+	endpoint, err := c.objectURL(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(query) > 0 {
+		endpoint += "?" + canonicalQuery(query)
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("creating request: %w", err)
+	}
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+	signS3Request(req, sha256Hex(body), now, c.region, c.accessKeyID, c.accessKeySecret)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		_ = resp.Body.Close()
+		return nil, &s3StatusError{
+			StatusCode: resp.StatusCode,
+			Status:     resp.Status,
+			Body:       strings.TrimSpace(string(respBody)),
+		}
+	}
+
+	return resp, nil
+}
+
+// objectURL returns the unsigned URL of an object, or of the bucket if key is empty.
+func (c S3Client) objectURL(key string) (string, error) {
+	endpoint, err := url.Parse(strings.TrimSuffix(c.endpoint, "/"))
+	if err != nil {
+		return "", fmt.Errorf("parsing endpoint %q: %w", c.endpoint, err)
+	}
+
+	escapedPath := endpoint.EscapedPath()
+	if c.virtualHosted {
+		endpoint.Host = c.bucket + "." + endpoint.Host
+	} else {
+		escapedPath += "/" + escapePathSegment(c.bucket)
+	}
+	if key != "" {
+		escapedPath += "/" + escapeObjectKey(key)
+	} else if c.virtualHosted {
+		escapedPath += "/"
+	}
+
+	return endpoint.Scheme + "://" + endpoint.Host + escapedPath, nil
+}
+
+func (c S3Client) multipartThresholdOrDefault() int64 {
+	if c.multipartThreshold > 0 {
+		return c.multipartThreshold
+	}
+	return defaultS3MultipartThreshold
+}
+
+func (c S3Client) partSizeOrDefault() int64 {
+	if c.partSize > 0 {
+		return c.partSize
+	}
+	return defaultS3PartSize
+}
+
+// retryableS3Error reports whether a failed request may succeed when sent again:
+// on throttling, server errors and transport errors such as timeouts and dropped connections.
+// Other errors, e.g. an invalid endpoint or a canceled request, are returned right away.
+func retryableS3Error(err error) bool {
+	var statusErr *s3StatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.StatusCode == http.StatusTooManyRequests || statusErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	// *url.Error is a net.Error itself, including when parsing the URL fails
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		err = urlErr.Err
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+func objectHeaders(contentType, cacheControl string) map[string]string {
+	headers := map[string]string{}
+	if contentType != "" {
+		headers["Content-Type"] = contentType
+	}
+	if cacheControl != "" {
+		headers["Cache-Control"] = cacheControl
+	}
+	return headers
+}
+
+// signS3Request adds AWS Signature Version 4 headers to req.
+func signS3Request(req *http.Request, payloadHash string, now time.Time, region, accessKeyID, accessKeySecret string) {
+	date := now.Format("20060102")
+	amzDate := now.Format("20060102T150405Z")
+	scope := date + "/" + region + "/s3/aws4_request"
+
+	req.Header.Set("x-amz-content-sha256", payloadHash)
+	req.Header.Set("x-amz-date", amzDate)
+
+	canonicalHeaders := "host:" + req.URL.Host + "\n" +
+		"x-amz-content-sha256:" + payloadHash + "\n" +
+		"x-amz-date:" + amzDate + "\n"
+	signedHeaders := "host;x-amz-content-sha256;x-amz-date"
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(req.URL.Query()),
+		canonicalHeaders,
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	stringToSign := strings.Join([]string{
+		"AWS4-HMAC-SHA256",
+		amzDate,
+		scope,
+		sha256Hex([]byte(canonicalRequest)),
+	}, "\n")
+
+	signingKey := awsSigningKey(accessKeySecret, date, region, "s3")
+	signature := hmacSHA256Hex(signingKey, stringToSign)
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKeyID,
+		scope,
+		signedHeaders,
+		signature,
+	))
+}
+
+// canonicalQuery encodes query parameters sorted by name, as SigV4 expects.
+func canonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, key := range keys {
+		values := append([]string(nil), query[key]...)
+		sort.Strings(values)
+		for _, value := range values {
+			parts = append(parts, escapeQueryComponent(key)+"="+escapeQueryComponent(value))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func escapeQueryComponent(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
+
+func awsSigningKey(secret, date, region, service string) []byte {
+	kDate := hmacSHA256([]byte("AWS4"+secret), date)
+	kRegion := hmacSHA256(kDate, region)
+	kService := hmacSHA256(kRegion, service)
+	return hmacSHA256(kService, "aws4_request")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+func hmacSHA256Hex(key []byte, data string) string {
+	return hex.EncodeToString(hmacSHA256(key, data))
+}
+
+func sha256Hex(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+func escapeObjectKey(key string) string {
+	parts := strings.Split(path.Clean(filepathSlash(key)), "/")
+	for i := range parts {
+		parts[i] = escapePathSegment(parts[i])
+	}
+	return strings.Join(parts, "/")
+}
+
+// escapePathSegment encodes a path segment as SigV4 canonical URIs require (RFC 3986):
+// everything but unreserved characters is percent-encoded, e.g. "Tom & Jerry (1940)" as "Tom%20%26%20Jerry%20%281940%29".
+// url.PathEscape leaves characters like "&", "(" and ":" as they are, and the signature wouldn't match.
+func escapePathSegment(segment string) string {
+	var b strings.Builder
+	for i := 0; i < len(segment); i++ {
+		c := segment[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+func filepathSlash(key string) string {
+	return strings.ReplaceAll(key, "\\", "/")
+}
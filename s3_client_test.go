@@ -0,0 +1,357 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+)
+
+type fakeS3Object struct {
+	body         string
+	etag         string
+	contentType  string
+	cacheControl string
+}
+
+type fakeS3Upload struct {
+	key    string
+	object fakeS3Object
+	parts  map[int][]byte
+}
+
+// fakeS3 is a minimal in-memory stand-in for an S3-compatible bucket using path-style addressing.
+type fakeS3 struct {
+	mu       sync.Mutex
+	bucket   string
+	objects  map[string]fakeS3Object
+	uploads  map[string]*fakeS3Upload // upload ID -> multipart upload in progress
+	requests []string
+	failPuts map[string]int // key -> number of PUTs to fail with 500
+}
+
+func newFakeS3(t *testing.T, bucket string) (*fakeS3, *httptest.Server) {
+	t.Helper()
+
+	fake := &fakeS3{
+		bucket:   bucket,
+		objects:  map[string]fakeS3Object{},
+		uploads:  map[string]*fakeS3Upload{},
+		failPuts: map[string]int{},
+	}
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+	return fake, server
+}
+
+// put stores an object with a single-part ETag.
+func (f *fakeS3) put(key, body string) {
+	sum := md5.Sum([]byte(body))
+	f.objects[key] = fakeS3Object{body: body, etag: hex.EncodeToString(sum[:])}
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=key-id/") {
+		http.Error(w, "missing signature", http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket)
+	if !ok {
+		http.Error(w, "no such bucket", http.StatusNotFound)
+		return
+	}
+	key = strings.TrimPrefix(key, "/")
+	f.requests = append(f.requests, r.Method+" "+key)
+
+	query := r.URL.Query()
+	body, _ := io.ReadAll(r.Body)
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && query.Get("list-type") == "2":
+		type content struct {
+			Key  string
+			ETag string
+			Size int
+		}
+		var result struct {
+			XMLName  xml.Name `xml:"ListBucketResult"`
+			Contents []content
+		}
+		for _, key := range sortedKeys(f.objects) {
+			if strings.HasPrefix(key, query.Get("prefix")) {
+				object := f.objects[key]
+				result.Contents = append(result.Contents, content{Key: key, ETag: `"` + object.etag + `"`, Size: len(object.body)})
+			}
+		}
+		_ = xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodHead:
+		object, ok := f.objects[key]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Header().Set("ETag", `"`+object.etag+`"`)
+		w.Header().Set("Content-Length", strconv.Itoa(len(object.body)))
+	case r.Method == http.MethodPost && query.Has("uploads"):
+		id := fmt.Sprintf("upload-%d", len(f.uploads)+1)
+		f.uploads[id] = &fakeS3Upload{
+			key:    key,
+			object: fakeS3Object{contentType: r.Header.Get("Content-Type"), cacheControl: r.Header.Get("Cache-Control")},
+			parts:  map[int][]byte{},
+		}
+		_, _ = fmt.Fprintf(w, "<InitiateMultipartUploadResult><UploadId>%s</UploadId></InitiateMultipartUploadResult>", id)
+	case r.Method == http.MethodPut && query.Has("uploadId"):
+		upload := f.uploads[query.Get("uploadId")]
+		number, _ := strconv.Atoi(query.Get("partNumber"))
+		upload.parts[number] = body
+		sum := md5.Sum(body)
+		w.Header().Set("ETag", `"`+hex.EncodeToString(sum[:])+`"`)
+	case r.Method == http.MethodPost && query.Has("uploadId"):
+		upload := f.uploads[query.Get("uploadId")]
+		var complete struct {
+			Parts []struct {
+				PartNumber int
+			} `xml:"Part"`
+		}
+		_ = xml.Unmarshal(body, &complete)
+
+		var content bytes.Buffer
+		sums := md5.New()
+		for _, part := range complete.Parts {
+			content.Write(upload.parts[part.PartNumber])
+			sum := md5.Sum(upload.parts[part.PartNumber])
+			sums.Write(sum[:])
+		}
+		upload.object.body = content.String()
+		upload.object.etag = fmt.Sprintf("%s-%d", hex.EncodeToString(sums.Sum(nil)), len(complete.Parts))
+		f.objects[upload.key] = upload.object
+		delete(f.uploads, query.Get("uploadId"))
+	case r.Method == http.MethodPut:
+		if f.failPuts[key] > 0 {
+			f.failPuts[key]--
+			http.Error(w, "try again", http.StatusInternalServerError)
+			return
+		}
+		sum := md5.Sum(body)
+		f.objects[key] = fakeS3Object{
+			body:         string(body),
+			etag:         hex.EncodeToString(sum[:]),
+			contentType:  r.Header.Get("Content-Type"),
+			cacheControl: r.Header.Get("Cache-Control"),
+		}
+	case r.Method == http.MethodDelete && query.Has("uploadId"):
+		delete(f.uploads, query.Get("uploadId"))
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "unexpected request", http.StatusBadRequest)
+	}
+}
+
+// mutating returns sorted non-GET/HEAD requests received since the last call.
+func (f *fakeS3) mutating() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var result []string
+	for _, request := range f.requests {
+		if !strings.HasPrefix(request, "GET ") && !strings.HasPrefix(request, "HEAD ") {
+			result = append(result, request)
+		}
+	}
+	sort.Strings(result)
+	f.requests = nil
+	return result
+}
+
+func TestS3ClientMultipartUpload(t *testing.T) {
+	fake, server := newFakeS3(t, "media")
+	client := S3Client{
+		endpoint:           server.URL,
+		region:             "auto",
+		bucket:             "media",
+		accessKeyID:        "key-id",
+		accessKeySecret:    "secret",
+		multipartThreshold: 10,
+		partSize:           8,
+	}
+
+	file := filepath.Join(t.TempDir(), "poster.jpg")
+	body := "0123456789abcdefghij" // 3 parts
+	mustWriteFile(t, file, body)
+
+	if err := client.PutFile("Movies/poster.jpg", file, "image/jpeg", "public, max-age=3600"); err != nil {
+		t.Fatalf("PutFile() error = %v", err)
+	}
+
+	object := fake.objects["Movies/poster.jpg"]
+	if object.body != body || object.contentType != "image/jpeg" || object.cacheControl != "public, max-age=3600" {
+		t.Fatalf("uploaded object = %#v", object)
+	}
+	if len(fake.uploads) != 0 {
+		t.Fatalf("multipart uploads left in progress: %v", fake.uploads)
+	}
+
+	etag, err := client.ContentETag(file)
+	if err != nil {
+		t.Fatalf("ContentETag() error = %v", err)
+	}
+	if etag != object.etag || !strings.HasSuffix(etag, "-3") {
+		t.Fatalf("ContentETag() = %q, want %q", etag, object.etag)
+	}
+
+	head, found, err := client.Head("Movies/poster.jpg")
+	if err != nil || !found {
+		t.Fatalf("Head() = %v, %v", found, err)
+	}
+	if head.ETag != object.etag || head.Size != int64(len(body)) {
+		t.Fatalf("Head() = %#v", head)
+	}
+
+	if _, found, err := client.Head("Movies/missing.jpg"); err != nil || found {
+		t.Fatalf("Head(missing) = %v, %v, want not found", found, err)
+	}
+}
+
+func TestS3ClientRetriesServerErrorsOnly(t *testing.T) {
+	fake, server := newFakeS3(t, "site")
+	fake.failPuts["a.txt"] = 2
+	client := S3Client{
+		endpoint:        server.URL,
+		region:          "auto",
+		bucket:          "site",
+		accessKeyID:     "key-id",
+		accessKeySecret: "secret",
+		attempts:        3,
+		retryDelay:      time.Millisecond,
+	}
+
+	if err := client.Put("a.txt", []byte("a"), "text/plain", ""); err != nil {
+		t.Fatalf("Put() error = %v", err)
+	}
+	if got := len(fake.mutating()); got != 3 {
+		t.Fatalf("Put() sent %d requests, want 3", got)
+	}
+
+	client.accessKeyID = "wrong"
+	if err := client.Put("a.txt", []byte("a"), "text/plain", ""); err == nil {
+		t.Fatalf("Put() with wrong credentials expected error")
+	}
+	if got := len(fake.mutating()); got != 0 {
+		t.Fatalf("forbidden request was retried %d times", got)
+	}
+}
+
+func TestRetryableS3Error(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"server error", &s3StatusError{StatusCode: http.StatusServiceUnavailable}, true},
+		{"throttled", &s3StatusError{StatusCode: http.StatusTooManyRequests}, true},
+		{"forbidden", &s3StatusError{StatusCode: http.StatusForbidden}, false},
+		{"connection refused", &url.Error{Op: "Put", URL: "http://s3", Err: &net.OpError{Op: "dial", Err: syscall.ECONNREFUSED}}, true},
+		{"dropped connection", &url.Error{Op: "Put", URL: "http://s3", Err: io.ErrUnexpectedEOF}, true},
+		{"canceled", &url.Error{Op: "Put", URL: "http://s3", Err: context.Canceled}, false},
+		{"invalid endpoint", fmt.Errorf("parsing endpoint: %w", &url.Error{Op: "parse", URL: "http://[s3", Err: errors.New("missing ']' in host")}), false},
+		{"reading file", fmt.Errorf("reading %q: %w", "a.txt", os.ErrPermission), false},
+	}
+	for _, tt := range tests {
+		if got := retryableS3Error(tt.err); got != tt.want {
+			t.Errorf("retryableS3Error(%s) = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestSignS3RequestEncodesReservedCharacters(t *testing.T) {
+	client := S3Client{endpoint: "https://s3.example.com", bucket: "site"}
+	endpoint, err := client.objectURL("Movies/Tom & Jerry (1940)=1,2;3:4@5!$*'.html")
+	if err != nil {
+		t.Fatalf("objectURL() error = %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPut, endpoint, nil)
+	if err != nil {
+		t.Fatalf("NewRequest() error = %v", err)
+	}
+
+	now := time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC)
+	payloadHash := sha256Hex(nil)
+	signS3Request(req, payloadHash, now, "auto", "key-id", "secret")
+
+	// canonical request as the server computes it: every reserved character of the key percent-encoded
+	canonicalURI := "/site/Movies/Tom%20%26%20Jerry%20%281940%29%3D1%2C2%3B3%3A4%405%21%24%2A%27.html"
+	if req.URL.EscapedPath() != canonicalURI {
+		t.Fatalf("request path = %q, want %q", req.URL.EscapedPath(), canonicalURI)
+	}
+	canonicalRequest := strings.Join([]string{
+		http.MethodPut,
+		canonicalURI,
+		"",
+		"host:s3.example.com\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:20260801T120000Z\n",
+		"host;x-amz-content-sha256;x-amz-date",
+		payloadHash,
+	}, "\n")
+	stringToSign := "AWS4-HMAC-SHA256\n20260801T120000Z\n20260801/auto/s3/aws4_request\n" + sha256Hex([]byte(canonicalRequest))
+	signature := hmacSHA256Hex(awsSigningKey("secret", "20260801", "auto", "s3"), stringToSign)
+
+	if got := req.Header.Get("Authorization"); !strings.HasSuffix(got, "Signature="+signature) {
+		t.Fatalf("Authorization = %q, want signature %s", got, signature)
+	}
+}
+
+func TestS3ClientObjectURL(t *testing.T) {
+	tests := []struct {
+		client S3Client
+		key    string
+		want   string
+	}{
+		{
+			client: S3Client{endpoint: "http://127.0.0.1:9000/", bucket: "site"},
+			key:    "Movies/Heat Part 2.html",
+			want:   "http://127.0.0.1:9000/site/Movies/Heat%20Part%202.html",
+		},
+		{
+			client: S3Client{endpoint: "https://s3.eu-west-1.amazonaws.com", bucket: "site", virtualHosted: true},
+			key:    "index.html",
+			want:   "https://site.s3.eu-west-1.amazonaws.com/index.html",
+		},
+		{
+			client: S3Client{endpoint: "https://s3.eu-west-1.amazonaws.com", bucket: "site", virtualHosted: true},
+			want:   "https://site.s3.eu-west-1.amazonaws.com/",
+		},
+	}
+
+	for _, tt := range tests {
+		got, err := tt.client.objectURL(tt.key)
+		if err != nil {
+			t.Fatalf("objectURL(%q) error = %v", tt.key, err)
+		}
+		if got != tt.want {
+			t.Errorf("objectURL(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/meilisearch/meilisearch-go"
+
+	"github.com/alsosee/finder/structs"
+)
+
+// SearchBackend stores search documents. Documents are identified by their ID field.
+type SearchBackend interface {
+	// Upsert adds documents to the index, replacing documents with the same ID.
+	Upsert(index string, documents []SearchDocument) error
+	// Delete removes documents by ID. Missing documents are ignored.
+	Delete(index string, ids []string) error
+	// ApplySettings updates index settings that differ from the given ones.
+	ApplySettings(index string, settings structs.SearchSettings) error
+	// Swap exchanges documents and settings of two indexes.
+	Swap(a, b string) error
+	// DeleteIndex removes an index with its documents and settings. A missing index is ignored.
+	DeleteIndex(index string) error
+	// Location identifies where indexes are stored, e.g. the server URL.
+	Location() string
+}
+
+const (
+	meilisearchBatchSize   = 100
+	meilisearchTaskTimeout = time.Minute * 2
+)
+
+type searchClient interface {
+	Index(uid string) searchIndex
+	GetTask(taskID int64) (*meilisearch.Task, error)
+	SwapIndexes(params []*meilisearch.SwapIndexesParams) (*meilisearch.TaskInfo, error)
+	CreateIndex(config *meilisearch.IndexConfig) (*meilisearch.TaskInfo, error)
+	DeleteIndex(uid string) (*meilisearch.TaskInfo, error)
+}
+
+type searchIndex interface {
+	AddDocumentsInBatches(documentsPtr interface{}, batchSize int, primaryKey ...string) ([]meilisearch.TaskInfo, error)
+	DeleteDocuments(identifiers []string) (*meilisearch.TaskInfo, error)
+	GetSettings() (*meilisearch.Settings, error)
+	UpdateSettings(request *meilisearch.Settings) (*meilisearch.TaskInfo, error)
+	UpdateSynonyms(request *map[string][]string) (*meilisearch.TaskInfo, error)
+}
+
+type meiliSearchClient struct {
+	client meilisearch.ServiceManager
+}
+
+func (c meiliSearchClient) Index(uid string) searchIndex {
+	return c.client.Index(uid)
+}
+
+func (c meiliSearchClient) GetTask(taskID int64) (*meilisearch.Task, error) {
+	return c.client.GetTask(taskID)
+}
+
+func (c meiliSearchClient) SwapIndexes(params []*meilisearch.SwapIndexesParams) (*meilisearch.TaskInfo, error) {
+	return c.client.SwapIndexes(params)
+}
+
+func (c meiliSearchClient) CreateIndex(config *meilisearch.IndexConfig) (*meilisearch.TaskInfo, error) {
+	return c.client.CreateIndex(config)
+}
+
+func (c meiliSearchClient) DeleteIndex(uid string) (*meilisearch.TaskInfo, error) {
+	return c.client.DeleteIndex(uid)
+}
+
+// meilisearchTaskError is the error of a failed task.
+type meilisearchTaskError struct {
+	code    string
+	message string
+}
+
+func (e meilisearchTaskError) Error() string {
+	return fmt.Sprintf("task failed: %s (%s)", e.message, e.code)
+}
+
+// MeilisearchBackend writes documents to a Meilisearch server
+// and waits for every task, so that a build fails if indexing fails.
+type MeilisearchBackend struct {
+	host   string
+	client searchClient
+}
+
+// NewMeilisearchBackend creates a backend for the Meilisearch server at host.
+func NewMeilisearchBackend(host string, client meilisearch.ServiceManager) MeilisearchBackend {
+	return MeilisearchBackend{host: host, client: meiliSearchClient{client: client}}
+}
+
+func (m MeilisearchBackend) Location() string {
+	return m.host
+}
+
+func (m MeilisearchBackend) Upsert(index string, documents []SearchDocument) error {
+	tasks, err := m.client.Index(index).AddDocumentsInBatches(documents, meilisearchBatchSize, "ID")
+	if err != nil {
+		return err
+	}
+
+	for _, task := range tasks {
+		if err := m.waitForTask(task.TaskUID); err != nil {
+			return fmt.Errorf("waiting for task %d: %w", task.TaskUID, err)
+		}
+	}
+	return nil
+}
+
+func (m MeilisearchBackend) Delete(index string, ids []string) error {
+	task, err := m.client.Index(index).DeleteDocuments(ids)
+	if err != nil {
+		return err
+	}
+
+	if err := m.waitForTask(task.TaskUID); err != nil {
+		return fmt.Errorf("waiting for task %d: %w", task.TaskUID, err)
+	}
+	return nil
+}
+
+// Swap creates indexes that don't exist yet, as Meilisearch only swaps existing ones.
+func (m MeilisearchBackend) Swap(a, b string) error {
+	for _, index := range []string{a, b} {
+		if err := m.createIndex(index); err != nil {
+			return fmt.Errorf("creating index %q: %w", index, err)
+		}
+	}
+
+	task, err := m.client.SwapIndexes([]*meilisearch.SwapIndexesParams{{Indexes: []string{a, b}}})
+	if err != nil {
+		return err
+	}
+
+	if err := m.waitForTask(task.TaskUID); err != nil {
+		return fmt.Errorf("waiting for task %d: %w", task.TaskUID, err)
+	}
+	return nil
+}
+
+func (m MeilisearchBackend) DeleteIndex(index string) error {
+	task, err := m.client.DeleteIndex(index)
+	if err != nil {
+		return err
+	}
+
+	err = m.waitForTask(task.TaskUID)
+	var taskErr meilisearchTaskError
+	if errors.As(err, &taskErr) && taskErr.code == "index_not_found" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("waiting for task %d: %w", task.TaskUID, err)
+	}
+	return nil
+}
+
+func (m MeilisearchBackend) createIndex(index string) error {
+	task, err := m.client.CreateIndex(&meilisearch.IndexConfig{Uid: index, PrimaryKey: "ID"})
+	if err != nil {
+		return err
+	}
+
+	err = m.waitForTask(task.TaskUID)
+	var taskErr meilisearchTaskError
+	if errors.As(err, &taskErr) && taskErr.code == "index_already_exists" {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("waiting for task %d: %w", task.TaskUID, err)
+	}
+	return nil
+}
+
+func (m MeilisearchBackend) waitForTask(taskID int64) error {
+	var (
+		task    *meilisearch.Task
+		err     error
+		delay   = time.Second
+		timeout = meilisearchTaskTimeout
+	)
+
+	for {
+		task, err = m.client.GetTask(taskID)
+		if err != nil {
+			return err
+		}
+
+		if task.Status == "succeeded" || task.Status == "failed" {
+			break
+		}
+
+		time.Sleep(delay)
+
+		// check timeout
+		timeout -= delay
+		if timeout <= 0 {
+			return fmt.Errorf("task timeout")
+		}
+
+		log.Printf("Task %d status: %s", taskID, task.Status)
+	}
+
+	if task.Status == "failed" {
+		return meilisearchTaskError{code: task.Error.Code, message: task.Error.Message}
+	}
+
+	return nil
+}
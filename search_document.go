@@ -0,0 +1,204 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"strings"
+
+	"github.com/alsosee/finder/structs"
+)
+
+const searchDefaultDocument = "default"
+
+// SearchDocument is a content as sent to the search backend (see README, "Search documents").
+// Keys are JSON names of content fields, plus fields derived from the content.
+type SearchDocument map[string]any
+
+// ID returns the document's primary key.
+func (d SearchDocument) ID() string {
+	id, _ := d["ID"].(string)
+	return id
+}
+
+// searchResultFields are content fields that every document has: the front end shows them in search results.
+var searchResultFields = func() []string {
+	fields := []string{"ID", "Source", "name", "title", "subtitle", "image"}
+	for _, column := range structs.ColumnsList {
+		fields = append(fields, column.Name)
+	}
+	return fields
+}()
+
+// searchContentFields are JSON names of content fields.
+var searchContentFields = func() map[string]bool {
+	fields := map[string]bool{}
+	t := reflect.TypeOf(structs.Content{})
+	for i := 0; i < t.NumField(); i++ {
+		name, _, _ := strings.Cut(t.Field(i).Tag.Get("json"), ",")
+		if name == "" {
+			name = t.Field(i).Name
+		}
+		if name != "-" {
+			fields[name] = true
+		}
+	}
+	return fields
+}()
+
+// searchProjection makes search documents of a type.
+type searchProjection struct {
+	fields []string // in addition to searchResultFields
+	people bool
+}
+
+// searchProjections are projections by root type directory.
+type searchProjections map[string]searchProjection
+
+// newSearchProjections parses search document definitions from the site config.
+func newSearchProjections(config map[string]structs.SearchDocument) (searchProjections, error) {
+	projections := searchProjections{}
+	for _, name := range sortedKeys(config) {
+		if _, ok := structs.RootTypes[name]; !ok && name != searchDefaultDocument {
+			return nil, fmt.Errorf("search document %q: unknown type, expected one of %s or %q", name, strings.Join(sortedKeys(structs.RootTypes), ", "), searchDefaultDocument)
+		}
+
+		definition := config[name]
+		for _, field := range definition.Fields {
+			if !searchContentFields[field] {
+				return nil, fmt.Errorf("search document %q: unknown field %q", name, field)
+			}
+		}
+
+		projections[name] = searchProjection{
+			fields: definition.Fields,
+			people: definition.People == nil || *definition.People,
+		}
+	}
+	return projections, nil
+}
+
+// For returns the projection of the content's type.
+func (p searchProjections) For(content *structs.Content) searchProjection {
+	if projection, ok := p[pathType(content.Source)]; ok {
+		return projection
+	}
+	if projection, ok := p[searchDefaultDocument]; ok {
+		return projection
+	}
+	return searchProjection{people: true}
+}
+
+// Document returns the search document of a content.
+func (p searchProjection) Document(content *structs.Content) (SearchDocument, error) {
+	b, err := json.Marshal(content)
+	if err != nil {
+		return nil, fmt.Errorf("marshaling %q: %w", content.Source, err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.UseNumber() // keep lengths in nanoseconds exact
+	var fields map[string]any
+	if err := decoder.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("unmarshaling %q: %w", content.Source, err)
+	}
+
+	document := SearchDocument{}
+	for _, list := range [][]string{searchResultFields, p.fields} {
+		for _, field := range list {
+			if value, ok := fields[field]; ok {
+				document[field] = value
+			}
+		}
+	}
+
+	document["type"] = content.Type()
+	if year := contentYear(content); year != 0 {
+		document["year"] = year
+	}
+	if len(content.Aliases) > 0 {
+		document["aliases"] = []string(content.Aliases)
+	}
+	if p.people {
+		if people := connectedPeople(content); len(people) > 0 {
+			document["people"] = people
+		}
+	}
+
+	return document, nil
+}
+
+// connectedPeople returns unique names of people the content refers to,
+// e.g. directors, writers and actors of a movie, in the order of the content's connections.
+func connectedPeople(content *structs.Content) []string {
+	var people []string
+	seen := map[string]bool{}
+	for _, connection := range content.Connections() {
+		path, ok := strings.CutPrefix(connection.To, "People/")
+		if !ok {
+			continue
+		}
+		name := filepath.Base(path)
+		if !seen[name] {
+			seen[name] = true
+			people = append(people, name)
+		}
+	}
+	return people
+}
+
+// searchDirectoryDocument returns the search document of a directory: its name, path,
+// number of items and the image of its first item that has one.
+// The source of a directory ends with "/", which also keeps its ID apart from a content with the same path.
+func searchDirectoryDocument(dir string, files []structs.File) SearchDocument {
+	source := dir + "/"
+	document := SearchDocument{
+		"ID":     searchDocumentIDForPath(source),
+		"Source": source,
+		"name":   filepath.Base(dir),
+		"path":   dir,
+		"type":   "directory",
+		"items":  len(files),
+	}
+	if image := searchDirectoryImage(files); image != nil {
+		document["image"] = image
+	}
+	return document
+}
+
+func searchDirectoryImage(files []structs.File) *structs.Media {
+	for _, file := range files {
+		if !file.IsFolder && file.Image != nil {
+			return file.Image
+		}
+	}
+	return nil
+}
+
+// searchDirectoryHash changes when the directory's document changes.
+func searchDirectoryHash(files []structs.File) string {
+	hashed := []string{fmt.Sprint(len(files))}
+	for _, file := range files {
+		hashed = append(hashed, file.Name)
+	}
+	if image := searchDirectoryImage(files); image != nil {
+		b, _ := json.Marshal(image)
+		hashed = append(hashed, string(b))
+	}
+	return hashStrings(hashed...)
+}
+
+// searchReferencedBy returns names of pages referencing a missing page, e.g. movies of a person without a page.
+func searchReferencedBy(graph *BuildGraph, id string) []string {
+	var names []string
+	for _, source := range graph.ReferencingSources(id) {
+		content := graph.Contents[removeFileExtention(source)]
+		name := content.Header()
+		if name == "" {
+			name = filepath.Base(content.SourceNoExtention)
+		}
+		names = append(names, name)
+	}
+	return names
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/alsosee/finder/structs"
+)
+
+func TestSearchProjectionDocument(t *testing.T) {
+	noPeople := false
+	projections, err := newSearchProjections(map[string]structs.SearchDocument{
+		"Movies": {Fields: []string{"description", "genres"}},
+		"People": {People: &noPeople},
+	})
+	if err != nil {
+		t.Fatalf("newSearchProjections() error = %v", err)
+	}
+
+	movie := &structs.Content{
+		ID:          "Movies_Heat",
+		Source:      "Movies/Heat.yml",
+		Title:       "Heat",
+		Description: "A group of bank robbers.",
+		Genres:      []string{"Crime"},
+		Released:    "December 15, 1995",
+		Directors:   []string{"Michael Mann"},
+		Characters:  []*structs.Character{{Name: "Neil McCauley", Actor: "Robert De Niro"}, {Name: "Vincent Hanna", Actor: "Michael Mann"}},
+		IMDB:        "tt0113277",
+		Aliases:     []string{"Жара"},
+	}
+	document, err := projections.For(movie).Document(movie)
+	if err != nil {
+		t.Fatalf("Document() error = %v", err)
+	}
+
+	want := SearchDocument{
+		"ID":          "Movies_Heat",
+		"Source":      "Movies/Heat.yml",
+		"title":       "Heat",
+		"description": "A group of bank robbers.",
+		"genres":      []any{"Crime"},
+		"released":    "December 15, 1995",
+		"directors":   []any{"Michael Mann"},
+		"type":        "movie",
+		"year":        1995,
+		"aliases":     []string{"Жара"},
+		"people":      []string{"Michael Mann", "Robert De Niro"},
+	}
+	if !reflect.DeepEqual(document, want) {
+		t.Fatalf("Document() = %#v, want %#v", document, want)
+	}
+
+	person := &structs.Content{ID: "People_Michael_Mann", Source: "People/Michael Mann.yml", Name: "Michael Mann", Description: "Director"}
+	document, err = projections.For(person).Document(person)
+	if err != nil {
+		t.Fatalf("Document() error = %v", err)
+	}
+	if _, ok := document["description"]; ok {
+		t.Fatalf("person document has a description not configured for people: %v", document)
+	}
+}
+
+func TestNewSearchProjectionsRejectsUnknownFields(t *testing.T) {
+	if _, err := newSearchProjections(map[string]structs.SearchDocument{"Movies": {Fields: []string{"plot"}}}); err == nil {
+		t.Fatal("newSearchProjections() with an unknown field error = nil")
+	}
+	if _, err := newSearchProjections(map[string]structs.SearchDocument{"Films": {}}); err == nil {
+		t.Fatal("newSearchProjections() with an unknown type error = nil")
+	}
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/meilisearch/meilisearch-go"
+
+	"github.com/alsosee/finder/structs"
+)
+
+// FileSearchBackend writes each index to <dir>/<index>.ndjson, one JSON document per line sorted by ID,
+// and its settings to <dir>/<index>.settings.json. It indexes without a search server,
+// e.g. to check what a build would send to Meilisearch.
+type FileSearchBackend struct {
+	dir string
+}
+
+// NewFileSearchBackend creates a backend that writes indexes to dir.
+func NewFileSearchBackend(dir string) FileSearchBackend {
+	return FileSearchBackend{dir: dir}
+}
+
+func (f FileSearchBackend) Location() string {
+	return f.dir
+}
+
+func (f FileSearchBackend) documentsPath(index string) string {
+	return filepath.Join(f.dir, index+".ndjson")
+}
+
+func (f FileSearchBackend) settingsPath(index string) string {
+	return filepath.Join(f.dir, index+".settings.json")
+}
+
+func (f FileSearchBackend) Upsert(index string, documents []SearchDocument) error {
+	stored, err := f.readDocuments(index)
+	if err != nil {
+		return err
+	}
+
+	for _, document := range documents {
+		b, err := json.Marshal(document)
+		if err != nil {
+			return fmt.Errorf("marshaling document %q: %w", document.ID(), err)
+		}
+		stored[document.ID()] = b
+	}
+
+	return f.writeDocuments(index, stored)
+}
+
+func (f FileSearchBackend) Delete(index string, ids []string) error {
+	stored, err := f.readDocuments(index)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range ids {
+		delete(stored, id)
+	}
+
+	return f.writeDocuments(index, stored)
+}
+
+func (f FileSearchBackend) ApplySettings(index string, settings structs.SearchSettings) error {
+	if isEmptySearchSettings(settings) {
+		return nil
+	}
+
+	// the settings a build sends to a new Meilisearch index, in the same format
+	payload, _ := searchSettingsUpdate(&meilisearch.Settings{}, settings)
+	b, err := json.MarshalIndent(payload, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling settings: %w", err)
+	}
+
+	current, err := os.ReadFile(f.settingsPath(index))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("reading settings: %w", err)
+	}
+	if bytes.Equal(current, b) {
+		log.Printf("Index %q settings are up to date", index)
+		return nil
+	}
+
+	log.Printf("Updating index %q settings", index)
+	return writeFileAtomic(f.settingsPath(index), b)
+}
+
+func (f FileSearchBackend) Swap(a, b string) error {
+	if err := swapFiles(f.documentsPath(a), f.documentsPath(b)); err != nil {
+		return fmt.Errorf("swapping documents: %w", err)
+	}
+	if err := swapFiles(f.settingsPath(a), f.settingsPath(b)); err != nil {
+		return fmt.Errorf("swapping settings: %w", err)
+	}
+	return nil
+}
+
+func (f FileSearchBackend) DeleteIndex(index string) error {
+	for _, path := range []string{f.documentsPath(index), f.settingsPath(index)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDocuments returns documents of the index by ID.
+func (f FileSearchBackend) readDocuments(index string) (map[string]json.RawMessage, error) {
+	documents := map[string]json.RawMessage{}
+
+	file, err := os.Open(f.documentsPath(index))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return documents, nil
+		}
+		return nil, fmt.Errorf("opening index %q: %w", index, err)
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(nil, 16<<20)
+	for line := 1; scanner.Scan(); line++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var document struct {
+			ID string `json:"ID"`
+		}
+		if err := json.Unmarshal(scanner.Bytes(), &document); err != nil {
+			return nil, fmt.Errorf("index %q, line %d: %w", index, line, err)
+		}
+		documents[document.ID] = bytes.Clone(scanner.Bytes())
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading index %q: %w", index, err)
+	}
+
+	return documents, nil
+}
+
+func (f FileSearchBackend) writeDocuments(index string, documents map[string]json.RawMessage) error {
+	var b bytes.Buffer
+	for _, id := range sortedKeys(documents) {
+		b.Write(documents[id])
+		b.WriteByte('\n')
+	}
+	return writeFileAtomic(f.documentsPath(index), b.Bytes())
+}
+
+// swapFiles exchanges two files, either of which may be missing.
+func swapFiles(a, b string) error {
+	tmp := a + ".swap"
+	for _, move := range [][2]string{{a, tmp}, {b, a}, {tmp, b}} {
+		if err := os.Rename(move[0], move[1]); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
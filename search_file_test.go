@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alsosee/finder/structs"
+)
+
+func TestIndexerWritesFileBackend(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, ".state")
+	backend := NewFileSearchBackend(filepath.Join(dir, "search"))
+
+	graph := testSearchGraph()
+	graph.Config.SearchSettings = structs.SearchSettings{FilterableAttributes: []string{"Type"}}
+	if err := NewIndexer(backend, graph).Index(stateFile, "info", ""); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if got, want := readNDJSONIDs(t, backend.documentsPath("info")), []string{"Movies_A", "Movies_B", "Movies_C"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("indexed IDs = %v, want %v", got, want)
+	}
+
+	b, err := os.ReadFile(backend.settingsPath("info"))
+	if err != nil {
+		t.Fatalf("reading settings: %v", err)
+	}
+	var settings map[string]any
+	if err := json.Unmarshal(b, &settings); err != nil {
+		t.Fatalf("unmarshaling settings: %v", err)
+	}
+	// the same names as in the Meilisearch settings payload
+	if want := map[string]any{"filterableAttributes": []any{"Type"}}; !reflect.DeepEqual(settings, want) {
+		t.Fatalf("settings = %v, want %v", settings, want)
+	}
+
+	// the second run deletes removed documents and keeps the rest
+	graph = testSearchGraph()
+	delete(graph.Contents, "Movies/C")
+	delete(graph.Hashes, "Movies/C.yml")
+	if err := NewIndexer(backend, graph).Index(stateFile, "info", ""); err != nil {
+		t.Fatalf("second Index() error = %v", err)
+	}
+	if got, want := readNDJSONIDs(t, backend.documentsPath("info")), []string{"Movies_A", "Movies_B"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("indexed IDs after delete = %v, want %v", got, want)
+	}
+}
+
+func TestFileSearchBackendSwap(t *testing.T) {
+	backend := NewFileSearchBackend(t.TempDir())
+	if err := backend.Upsert("info", []SearchDocument{{"ID": "old"}}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if err := backend.Upsert("info_next", []SearchDocument{{"ID": "new"}}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+	if err := backend.ApplySettings("info_next", structs.SearchSettings{StopWords: []string{"the"}}); err != nil {
+		t.Fatalf("ApplySettings() error = %v", err)
+	}
+
+	if err := backend.Swap("info", "info_next"); err != nil {
+		t.Fatalf("Swap() error = %v", err)
+	}
+
+	if got, want := readNDJSONIDs(t, backend.documentsPath("info")), []string{"new"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("info IDs = %v, want %v", got, want)
+	}
+	if got, want := readNDJSONIDs(t, backend.documentsPath("info_next")), []string{"old"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("info_next IDs = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(backend.settingsPath("info")); err != nil {
+		t.Fatalf("settings of info after swap: %v", err)
+	}
+	if _, err := os.Stat(backend.settingsPath("info_next")); !os.IsNotExist(err) {
+		t.Fatalf("info_next has settings after swap, error = %v", err)
+	}
+}
+
+func readNDJSONIDs(t *testing.T, path string) []string {
+	t.Helper()
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("opening %q: %v", path, err)
+	}
+	defer func() { _ = f.Close() }()
+
+	var ids []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var document struct{ ID string }
+		if err := json.Unmarshal(scanner.Bytes(), &document); err != nil {
+			t.Fatalf("unmarshaling %q: %v", scanner.Text(), err)
+		}
+		ids = append(ids, document.ID)
+	}
+	return ids
+}
+
+func TestIndexerRebuildRemovesStaleDocuments(t *testing.T) {
+	dir := t.TempDir()
+	backend := NewFileSearchBackend(dir)
+	if err := backend.Upsert("info", []SearchDocument{{"ID": "Movies_Renamed"}}); err != nil {
+		t.Fatalf("Upsert() error = %v", err)
+	}
+
+	if err := NewIndexer(backend, testSearchGraph()).Index(filepath.Join(dir, ".state"), "info", "all"); err != nil {
+		t.Fatalf("Index(all) error = %v", err)
+	}
+
+	if got, want := readNDJSONIDs(t, backend.documentsPath("info")), []string{"Movies_A", "Movies_B", "Movies_C"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("indexed IDs = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(backend.documentsPath("info" + searchRebuildSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("rebuild index is left after the swap, error = %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/meilisearch/meilisearch-go"
+
+	"github.com/alsosee/finder/structs"
+)
+
+// ApplySettings updates index settings that differ from the site config
+// and waits for the update, so that documents are indexed with the new settings.
+func (m MeilisearchBackend) ApplySettings(index string, settings structs.SearchSettings) error {
+	if isEmptySearchSettings(settings) {
+		return nil
+	}
+
+	current, err := m.client.Index(index).GetSettings()
+	if err != nil {
+		var apiErr *meilisearch.Error
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+			return fmt.Errorf("getting settings: %w", err)
+		}
+		// the index is created by the update
+		current = &meilisearch.Settings{}
+	}
+
+	update, changed := searchSettingsUpdate(current, settings)
+	if len(changed) == 0 {
+		log.Printf("Index %q settings are up to date", index)
+		return nil
+	}
+
+	log.Printf("Updating index %q settings: %v", index, changed)
+	if update.Synonyms != nil && len(update.Synonyms) == 0 {
+		// an empty map is omitted from the settings payload, so synonyms are reset on their own
+		task, err := m.client.Index(index).UpdateSynonyms(&update.Synonyms)
+		if err != nil {
+			return fmt.Errorf("resetting synonyms: %w", err)
+		}
+		if err := m.waitForTask(task.TaskUID); err != nil {
+			return fmt.Errorf("waiting for task %d: %w", task.TaskUID, err)
+		}
+		if len(changed) == 1 {
+			return nil
+		}
+		update.Synonyms = nil
+	}
+
+	task, err := m.client.Index(index).UpdateSettings(update)
+	if err != nil {
+		return fmt.Errorf("updating settings: %w", err)
+	}
+	if err := m.waitForTask(task.TaskUID); err != nil {
+		return fmt.Errorf("waiting for task %d: %w", task.TaskUID, err)
+	}
+
+	return nil
+}
+
+// searchSynonyms returns synonyms from the config with names and aliases of contents added:
+// every name of a content is a synonym of its other names, e.g. "лев толстой" of "leo tolstoy".
+// Synonyms are lowercased, as search is case-insensitive.
+func searchSynonyms(graph *BuildGraph) map[string][]string {
+	sets := map[string]map[string]bool{}
+	add := func(word string, synonyms ...string) {
+		word = strings.ToLower(strings.TrimSpace(word))
+		for _, synonym := range synonyms {
+			synonym = strings.ToLower(strings.TrimSpace(synonym))
+			if word == "" || synonym == "" || synonym == word {
+				continue
+			}
+			if sets[word] == nil {
+				sets[word] = map[string]bool{}
+			}
+			sets[word][synonym] = true
+		}
+	}
+
+	for word, synonyms := range graph.Config.SearchSettings.Synonyms {
+		add(word, synonyms...)
+	}
+	for _, id := range sortedKeys(graph.Contents) {
+		content := graph.Contents[id]
+		if len(content.Aliases) == 0 {
+			continue
+		}
+		name := content.Header()
+		if name == "" {
+			name = filepath.Base(id)
+		}
+		names := append([]string{name}, content.Aliases...)
+		for _, name := range names {
+			add(name, names...)
+		}
+	}
+
+	if len(sets) == 0 {
+		return nil
+	}
+	synonyms := make(map[string][]string, len(sets))
+	for word, set := range sets {
+		synonyms[word] = sortedKeys(set)
+	}
+	return synonyms
+}
+
+func isEmptySearchSettings(settings structs.SearchSettings) bool {
+	return len(settings.SearchableAttributes) == 0 &&
+		len(settings.FilterableAttributes) == 0 &&
+		len(settings.SortableAttributes) == 0 &&
+		len(settings.DisplayedAttributes) == 0 &&
+		len(settings.RankingRules) == 0 &&
+		len(settings.StopWords) == 0 &&
+		settings.Synonyms == nil &&
+		settings.TypoTolerance == nil
+}
+
+// searchSettingsUpdate returns settings to send to make the index match the config,
+// and names of the settings that differ. Settings missing from the config are not sent.
+func searchSettingsUpdate(current *meilisearch.Settings, want structs.SearchSettings) (*meilisearch.Settings, []string) {
+	update := &meilisearch.Settings{}
+	var changed []string
+
+	// order of searchable attributes and ranking rules matters, other lists are sets
+	if len(want.SearchableAttributes) > 0 && !slices.Equal(current.SearchableAttributes, want.SearchableAttributes) {
+		update.SearchableAttributes = want.SearchableAttributes
+		changed = append(changed, "searchableAttributes")
+	}
+	if len(want.RankingRules) > 0 && !slices.Equal(current.RankingRules, want.RankingRules) {
+		update.RankingRules = want.RankingRules
+		changed = append(changed, "rankingRules")
+	}
+	if len(want.FilterableAttributes) > 0 && !sameSet(current.FilterableAttributes, want.FilterableAttributes) {
+		update.FilterableAttributes = want.FilterableAttributes
+		changed = append(changed, "filterableAttributes")
+	}
+	if len(want.SortableAttributes) > 0 && !sameSet(current.SortableAttributes, want.SortableAttributes) {
+		update.SortableAttributes = want.SortableAttributes
+		changed = append(changed, "sortableAttributes")
+	}
+	if len(want.DisplayedAttributes) > 0 && !sameSet(current.DisplayedAttributes, want.DisplayedAttributes) {
+		update.DisplayedAttributes = want.DisplayedAttributes
+		changed = append(changed, "displayedAttributes")
+	}
+	if len(want.StopWords) > 0 && !sameSet(current.StopWords, want.StopWords) {
+		update.StopWords = want.StopWords
+		changed = append(changed, "stopWords")
+	}
+
+	// synonyms are set by the build once there are any, an empty set resets them
+	if want.Synonyms != nil && !sameSynonyms(current.Synonyms, want.Synonyms) {
+		update.Synonyms = want.Synonyms
+		changed = append(changed, "synonyms")
+	}
+
+	if want.TypoTolerance != nil {
+		// typo tolerance is sent as a whole, fields missing from the config keep current values
+		typo := meilisearch.TypoTolerance{Enabled: true}
+		if current.TypoTolerance != nil {
+			typo = *current.TypoTolerance
+		}
+		next := typo
+		if want.TypoTolerance.Enabled != nil {
+			next.Enabled = *want.TypoTolerance.Enabled
+		}
+		if want.TypoTolerance.OneTypo != 0 {
+			next.MinWordSizeForTypos.OneTypo = want.TypoTolerance.OneTypo
+		}
+		if want.TypoTolerance.TwoTypos != 0 {
+			next.MinWordSizeForTypos.TwoTypos = want.TypoTolerance.TwoTypos
+		}
+		if want.TypoTolerance.DisableOnWords != nil {
+			next.DisableOnWords = want.TypoTolerance.DisableOnWords
+		}
+		if want.TypoTolerance.DisableOnAttributes != nil {
+			next.DisableOnAttributes = want.TypoTolerance.DisableOnAttributes
+		}
+
+		if next.Enabled != typo.Enabled ||
+			next.MinWordSizeForTypos != typo.MinWordSizeForTypos ||
+			!sameSet(next.DisableOnWords, typo.DisableOnWords) ||
+			!sameSet(next.DisableOnAttributes, typo.DisableOnAttributes) {
+			update.TypoTolerance = &next
+			changed = append(changed, "typoTolerance")
+		}
+	}
+
+	return update, changed
+}
+
+func sameSynonyms(a, b map[string][]string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for word, synonyms := range a {
+		if other, ok := b[word]; !ok || !sameSet(synonyms, other) {
+			return false
+		}
+	}
+	return true
+}
+
+func sameSet(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	a, b = slices.Clone(a), slices.Clone(b)
+	sort.Strings(a)
+	sort.Strings(b)
+	return slices.Equal(a, b)
+}
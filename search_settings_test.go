@@ -0,0 +1,148 @@
+package main
+
+import (
+	"path/filepath"
+	"reflect"
+	"slices"
+	"testing"
+
+	"github.com/meilisearch/meilisearch-go"
+
+	"github.com/alsosee/finder/structs"
+)
+
+func TestMeilisearchBackendApplySettingsIsIdempotent(t *testing.T) {
+	disabled := false
+	graph := testSearchGraph()
+	graph.Config.SearchSettings = structs.SearchSettings{
+		SearchableAttributes: []string{"Name", "Title", "Description"},
+		FilterableAttributes: []string{"Type", "Released"},
+		StopWords:            []string{"the", "a"},
+		TypoTolerance:        &structs.SearchTypoTolerance{OneTypo: 4, DisableOnAttributes: []string{"Released"}},
+	}
+
+	// defaults of a new index
+	index := &fakeSearchIndex{settings: &meilisearch.Settings{
+		SearchableAttributes: []string{"*"},
+		FilterableAttributes: []string{"Released", "Type"},
+		RankingRules:         []string{"words", "typo", "proximity", "attribute", "sort", "exactness"},
+		TypoTolerance: &meilisearch.TypoTolerance{
+			Enabled:             true,
+			MinWordSizeForTypos: meilisearch.MinWordSizeForTypos{OneTypo: 5, TwoTypos: 9},
+		},
+	}}
+	backend := MeilisearchBackend{client: &fakeSearchClient{index: index}}
+
+	if err := backend.ApplySettings("info", graph.Config.SearchSettings); err != nil {
+		t.Fatalf("ApplySettings() error = %v", err)
+	}
+	if len(index.updates) != 1 {
+		t.Fatalf("ApplySettings() sent %d updates, want 1", len(index.updates))
+	}
+	want := &meilisearch.Settings{
+		SearchableAttributes: []string{"Name", "Title", "Description"},
+		StopWords:            []string{"the", "a"},
+		TypoTolerance: &meilisearch.TypoTolerance{
+			Enabled:             true,
+			MinWordSizeForTypos: meilisearch.MinWordSizeForTypos{OneTypo: 4, TwoTypos: 9},
+			DisableOnAttributes: []string{"Released"},
+		},
+	}
+	if !reflect.DeepEqual(index.updates[0], want) {
+		t.Fatalf("ApplySettings() sent %+v, want %+v", index.updates[0], want)
+	}
+
+	// the instance now has the settings (stop words in a different order)
+	index.settings.SearchableAttributes = want.SearchableAttributes
+	index.settings.StopWords = []string{"a", "the"}
+	index.settings.TypoTolerance = want.TypoTolerance
+	if err := backend.ApplySettings("info", graph.Config.SearchSettings); err != nil {
+		t.Fatalf("second ApplySettings() error = %v", err)
+	}
+	if len(index.updates) != 1 {
+		t.Fatalf("second ApplySettings() sent an update: %+v", index.updates[1])
+	}
+
+	graph.Config.SearchSettings.TypoTolerance.Enabled = &disabled
+	if err := backend.ApplySettings("info", graph.Config.SearchSettings); err != nil {
+		t.Fatalf("ApplySettings() error = %v", err)
+	}
+	if len(index.updates) != 2 || index.updates[1].TypoTolerance == nil || index.updates[1].TypoTolerance.Enabled {
+		t.Fatalf("ApplySettings() did not disable typo tolerance: %+v", index.updates)
+	}
+}
+
+func TestMeilisearchBackendApplySettingsSkipsWithoutConfig(t *testing.T) {
+	index := &fakeSearchIndex{}
+	backend := MeilisearchBackend{client: &fakeSearchClient{index: index}}
+
+	if err := backend.ApplySettings("info", structs.SearchSettings{}); err != nil {
+		t.Fatalf("ApplySettings() error = %v", err)
+	}
+	if len(index.updates) != 0 {
+		t.Fatalf("ApplySettings() without settings sent %+v", index.updates)
+	}
+}
+
+func TestIndexerPushesSynonymsFromAliases(t *testing.T) {
+	graph := testSearchGraph()
+	graph.Contents["People/Leo Tolstoy"] = structs.Content{Source: "People/Leo Tolstoy.yml", Name: "Leo Tolstoy", Aliases: []string{"Лев Толстой"}}
+	graph.Hashes["People/Leo Tolstoy.yml"] = "new"
+	graph.Config.SearchSettings.Synonyms = map[string][]string{"NYC": {"New York"}}
+
+	index := &fakeSearchIndex{}
+	if err := NewIndexer(MeilisearchBackend{client: &fakeSearchClient{index: index}}, graph).Index(filepath.Join(t.TempDir(), ".state"), "info", ""); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+
+	want := map[string][]string{
+		"nyc":         {"new york"},
+		"leo tolstoy": {"лев толстой"},
+		"лев толстой": {"leo tolstoy"},
+	}
+	if len(index.updates) != 1 || !reflect.DeepEqual(index.updates[0].Synonyms, want) {
+		t.Fatalf("settings updates = %+v, want synonyms %v", index.updates, want)
+	}
+
+	// synonyms in another order are the same
+	index.settings = &meilisearch.Settings{Synonyms: map[string][]string{"nyc": {"new york"}, "лев толстой": {"leo tolstoy"}, "leo tolstoy": {"лев толстой"}}}
+	if _, changed := searchSettingsUpdate(index.settings, structs.SearchSettings{Synonyms: want}); len(changed) != 0 {
+		t.Fatalf("searchSettingsUpdate() changed %v for the same synonyms", changed)
+	}
+}
+
+func TestIndexerResetsSynonymsWhenLastAliasIsRemoved(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), ".state")
+	index := &fakeSearchIndex{}
+	client := &fakeSearchClient{index: index}
+
+	graph := testSearchGraph()
+	graph.Contents["People/Leo Tolstoy"] = structs.Content{Source: "People/Leo Tolstoy.yml", Name: "Leo Tolstoy", Aliases: []string{"Лев Толстой"}}
+	graph.Hashes["People/Leo Tolstoy.yml"] = "new"
+	if err := NewIndexer(MeilisearchBackend{client: client}, graph).Index(stateFile, "info", ""); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	index.settings = &meilisearch.Settings{Synonyms: index.updates[0].Synonyms}
+
+	// generated synonyms are updated in place, without a rebuild
+	client.calls = nil
+	delete(graph.Contents, "People/Leo Tolstoy")
+	delete(graph.Hashes, "People/Leo Tolstoy.yml")
+	if err := NewIndexer(MeilisearchBackend{client: client}, graph).Index(stateFile, "info", ""); err != nil {
+		t.Fatalf("Index() error = %v", err)
+	}
+	if slices.Contains(client.calls, "swap info info_rebuild") {
+		t.Fatalf("calls = %v, want the index updated in place", client.calls)
+	}
+	if want := []map[string][]string{{}}; !reflect.DeepEqual(index.synonyms, want) {
+		t.Fatalf("synonym updates = %v, want %v", index.synonyms, want)
+	}
+
+	state, err := readSearchState(stateFile, SearchState{})
+	if err != nil {
+		t.Fatalf("readSearchState() error = %v", err)
+	}
+	if state.Synonyms {
+		t.Fatal("state still has synonyms after they were reset")
+	}
+}
@@ -0,0 +1,134 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+
+	"github.com/alsosee/finder/structs"
+)
+
+// searchStateVersion is the version of the search state file format.
+// Files without a version are tab-separated "path\thash" lines written by older versions.
+const searchStateVersion = 1
+
+// searchDocumentsVersion changes when search documents change in a way their hashes don't show,
+// e.g. when a field is added to every document, so that the index is rebuilt.
+const searchDocumentsVersion = "1"
+
+// SearchState records what was sent to a search index, so that the next run only sends changes.
+type SearchState struct {
+	Version   int               `json:"version"`
+	Index     string            `json:"index"`
+	Host      string            `json:"host"`
+	Settings  string            `json:"settings"`           // hash of index settings and document definitions
+	Synonyms  bool              `json:"synonyms,omitempty"` // index synonyms were set by the build, so they are reset when none are left
+	Documents map[string]string `json:"documents"`          // document hashes by path
+}
+
+// searchSettingsHash returns a hash of everything besides the documents' own content that affects the index:
+// index settings from the config and document definitions. Synonyms generated from contents are left out,
+// as they are updated in place.
+func searchSettingsHash(settings structs.SearchSettings, documents map[string]structs.SearchDocument) (string, error) {
+	settingsJSON, err := json.Marshal(settings)
+	if err != nil {
+		return "", fmt.Errorf("marshaling search settings: %w", err)
+	}
+	documentsJSON, err := json.Marshal(documents)
+	if err != nil {
+		return "", fmt.Errorf("marshaling search documents: %w", err)
+	}
+	return hashStrings(searchDocumentsVersion, string(settingsJSON), string(documentsJSON)), nil
+}
+
+// rebuildReason returns why the index must be rebuilt to match the state, or an empty string.
+func (s SearchState) rebuildReason(next SearchState) string {
+	switch {
+	case len(s.Documents) == 0:
+		return ""
+	case s.Index != next.Index:
+		return fmt.Sprintf("index changed from %q to %q", s.Index, next.Index)
+	case s.Host != next.Host:
+		return fmt.Sprintf("host changed from %q to %q", s.Host, next.Host)
+	case s.Settings != next.Settings:
+		return "settings changed"
+	}
+	return ""
+}
+
+// readSearchState reads a state file. A missing or empty file is an empty state.
+// A state in the old tab-separated format is taken as written for the given index, host and settings.
+func readSearchState(path string, current SearchState) (SearchState, error) {
+	state := SearchState{Documents: map[string]string{}}
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return state, nil
+		}
+		return state, fmt.Errorf("reading state file: %w", err)
+	}
+	b = bytes.TrimSpace(b)
+	if len(b) == 0 {
+		return state, nil
+	}
+
+	if b[0] != '{' {
+		documents, err := parseTSVSearchState(b)
+		if err != nil {
+			return state, err
+		}
+		state = current
+		state.Documents = documents
+		return state, nil
+	}
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, fmt.Errorf("unmarshaling state file: %w", err)
+	}
+	if state.Version > searchStateVersion {
+		return state, fmt.Errorf("state file version %d is newer than supported version %d", state.Version, searchStateVersion)
+	}
+	if state.Documents == nil {
+		state.Documents = map[string]string{}
+	}
+	return state, nil
+}
+
+func parseTSVSearchState(b []byte) (map[string]string, error) {
+	documents := map[string]string{}
+
+	scanner := bufio.NewScanner(bytes.NewReader(b))
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" {
+			continue
+		}
+		parts := strings.Split(line, "\t")
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid state file format")
+		}
+		documents[parts[0]] = parts[1]
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading state file: %w", err)
+	}
+
+	return documents, nil
+}
+
+// writeSearchState writes the state file through a temporary file,
+// so that an interrupted build doesn't leave a broken state.
+func writeSearchState(path string, state SearchState) error {
+	state.Version = searchStateVersion
+	b, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshaling state: %w", err)
+	}
+	return writeFileAtomic(path, append(b, '\n'))
+}
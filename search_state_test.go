@@ -0,0 +1,94 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alsosee/finder/structs"
+)
+
+func TestReadSearchStateMigratesTSV(t *testing.T) {
+	path := filepath.Join(t.TempDir(), ".state")
+	if err := os.WriteFile(path, []byte("Movies/A.yml\t1a2b\nMovies/B.yml\t3c4d\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	current := SearchState{Index: "info", Host: "https://search.example.test", Settings: "hash"}
+	state, err := readSearchState(path, current)
+	if err != nil {
+		t.Fatalf("readSearchState() error = %v", err)
+	}
+
+	want := current
+	want.Documents = map[string]string{"Movies/A.yml": "1a2b", "Movies/B.yml": "3c4d"}
+	if !reflect.DeepEqual(state, want) {
+		t.Fatalf("readSearchState() = %+v, want %+v", state, want)
+	}
+	if reason := state.rebuildReason(current); reason != "" {
+		t.Fatalf("migrated state needs a rebuild: %s", reason)
+	}
+}
+
+func TestSearchStateRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "search.json")
+	state := SearchState{Index: "info", Host: "h", Settings: "s", Documents: map[string]string{"Movies/A.yml": "1"}}
+	if err := writeSearchState(path, state); err != nil {
+		t.Fatalf("writeSearchState() error = %v", err)
+	}
+
+	got, err := readSearchState(path, SearchState{})
+	if err != nil {
+		t.Fatalf("readSearchState() error = %v", err)
+	}
+	state.Version = searchStateVersion
+	if !reflect.DeepEqual(got, state) {
+		t.Fatalf("readSearchState() = %+v, want %+v", got, state)
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Fatalf("temporary state file is left, error = %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte(`{"version": 99}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := readSearchState(path, SearchState{}); err == nil {
+		t.Fatal("readSearchState() of a newer version error = nil")
+	}
+}
+
+func TestIndexerRebuildsWhenSettingsChange(t *testing.T) {
+	dir := t.TempDir()
+	stateFile := filepath.Join(dir, ".state")
+	backend := NewFileSearchBackend(filepath.Join(dir, "search"))
+	index := func(settings structs.SearchSettings) {
+		t.Helper()
+		graph := testSearchGraph()
+		graph.Config.SearchSettings = settings
+		if err := NewIndexer(backend, graph).Index(stateFile, "info", ""); err != nil {
+			t.Fatalf("Index() error = %v", err)
+		}
+	}
+	addStale := func() {
+		t.Helper()
+		if err := backend.Upsert("info", []SearchDocument{{"ID": "Movies_Stale"}}); err != nil {
+			t.Fatalf("Upsert() error = %v", err)
+		}
+	}
+
+	index(structs.SearchSettings{})
+	addStale()
+
+	// same settings: updated in place
+	index(structs.SearchSettings{})
+	if got, want := readNDJSONIDs(t, backend.documentsPath("info")), []string{"Movies_A", "Movies_B", "Movies_C", "Movies_Stale"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("indexed IDs = %v, want %v", got, want)
+	}
+
+	// new settings: rebuilt
+	index(structs.SearchSettings{StopWords: []string{"the"}})
+	if got, want := readNDJSONIDs(t, backend.documentsPath("info")), []string{"Movies_A", "Movies_B", "Movies_C"}; !reflect.DeepEqual(got, want) {
+		t.Fatalf("indexed IDs after settings change = %v, want %v", got, want)
+	}
+}
@@ -1,50 +1,147 @@
 package main
 
 import (
+	"bytes"
+	"compress/gzip"
 	"encoding/xml"
 	"fmt"
+	"log"
 	"net/url"
 	"os"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 	"time"
 )
 
+// Sitemaps are split by top-level directory into files of up to sitemapMaxURLs URLs and sitemapMaxBytes,
+// the limits of the sitemap protocol (https://www.sitemaps.org/protocol.html), e.g.
+//
+//	sitemap-movies-1.xml   URLs in Movies/
+//	sitemap-pages-1.xml    the home page and files in the root directory
+//
+// and listed in sitemap_index.xml. sitemap.xml keeps listing all URLs while they fit in one sitemap;
+// on a larger site it becomes a copy of the index, so that search engines that refer to it find all sitemaps.
+const (
+	sitemapMaxURLs  = 50000
+	sitemapMaxBytes = 50 * 1024 * 1024
+
+	sitemapIndexFile = "sitemap_index.xml"
+	sitemapNamespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+)
+
 type SitemapProjector struct {
 	infoDir   string
 	outputDir string
+	gzip      bool // also write sitemaps as .xml.gz and list those in the index
+	clock     buildClock
+	out       *outputWriter
 }
 
 func (p SitemapProjector) Name() string {
 	return "sitemap"
 }
 
+func (p SitemapProjector) Outputs() []OutputFile {
+	if p.out == nil {
+		return nil
+	}
+	return p.out.Outputs()
+}
+
 func (p SitemapProjector) Run(graph *BuildGraph) error {
 	if strings.TrimSpace(graph.Config.URL) == "" {
 		return fmt.Errorf("site URL is required to generate sitemap")
 	}
 
-	outPath := filepath.Join(p.outputDir, "sitemap.xml")
-	if err := os.MkdirAll(filepath.Dir(outPath), 0o755); err != nil {
-		return fmt.Errorf("creating sitemap output dir: %w", err)
+	if p.out == nil {
+		p.out = newOutputWriter()
+	}
+
+	baseURL := strings.TrimRight(graph.Config.URL, "/")
+	entries := sitemapEntries(graph, p.infoDir, p.clock)
+	index := sitemapIndex{XMLNS: sitemapNamespace}
+	for _, sitemap := range splitSitemaps(entries) {
+		data, err := marshalSitemap(newSitemapURLSet(sitemap.urls))
+		if err != nil {
+			return err
+		}
+		if err := p.write(sitemap.name, data); err != nil {
+			return err
+		}
+
+		name := sitemap.name
+		if p.gzip {
+			name += ".gz"
+			compressed, err := gzipSitemap(data)
+			if err != nil {
+				return fmt.Errorf("compressing sitemap %q: %w", sitemap.name, err)
+			}
+			if err := p.write(name, compressed); err != nil {
+				return err
+			}
+		}
+
+		index.Sitemaps = append(index.Sitemaps, sitemapIndexEntry{
+			Loc:     baseURL + "/" + name,
+			LastMod: sitemap.lastMod(),
+		})
 	}
 
-	data, err := xml.MarshalIndent(newSitemapURLSet(sitemapEntries(graph, p.infoDir)), "", "  ")
+	data, err := marshalSitemap(index)
 	if err != nil {
-		return fmt.Errorf("marshaling sitemap xml: %w", err)
+		return err
+	}
+	if err := p.write(sitemapIndexFile, data); err != nil {
+		return err
 	}
 
-	data = append([]byte(xml.Header), data...)
-	data = append(data, '\n')
+	if fitsOneSitemap(entries) {
+		if data, err = marshalSitemap(newSitemapURLSet(entries)); err != nil {
+			return err
+		}
+	} else {
+		log.Printf("Sitemap: %d URLs don't fit in one sitemap, sitemap.xml is a sitemap index now; point robots.txt to %s", len(entries), sitemapIndexFile)
+	}
+	return p.write("sitemap.xml", data)
+}
 
-	if err := os.WriteFile(outPath, data, 0o644); err != nil {
+func (p SitemapProjector) write(name string, data []byte) error {
+	outPath := filepath.Join(p.outputDir, name)
+	if _, err := p.out.WriteFile(outPath, data); err != nil {
 		return fmt.Errorf("writing sitemap %q: %w", outPath, err)
 	}
-
 	return nil
 }
 
+func marshalSitemap(v any) ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshaling sitemap xml: %w", err)
+	}
+
+	data = append([]byte(xml.Header), data...)
+	return append(data, '\n'), nil
+}
+
+// gzipSitemap compresses a sitemap without a name or modification time in the header,
+// so that the same sitemap compresses to the same bytes.
+func gzipSitemap(data []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, err := gzip.NewWriterLevel(&b, gzip.BestCompression)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(data); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
 type sitemapURLSet struct {
 	XMLName xml.Name     `xml:"urlset"`
 	XMLNS   string       `xml:"xmlns,attr"`
@@ -54,6 +151,124 @@ type sitemapURLSet struct {
 type sitemapURL struct {
 	Loc     string `xml:"loc"`
 	LastMod string `xml:"lastmod,omitempty"`
+
+	group string // top-level directory, or an empty string for the home page and files in the root directory
+}
+
+type sitemapIndex struct {
+	XMLName  xml.Name            `xml:"sitemapindex"`
+	XMLNS    string              `xml:"xmlns,attr"`
+	Sitemaps []sitemapIndexEntry `xml:"sitemap"`
+}
+
+type sitemapIndexEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+// sitemapFile is a part of the sitemap written to its own file.
+type sitemapFile struct {
+	name string
+	urls []sitemapURL
+}
+
+// lastMod returns the latest modification date of the sitemap's URLs, or an empty string.
+func (f sitemapFile) lastMod() string {
+	var latest string
+	for _, url := range f.urls {
+		// dates are in UTC and the same format, so they sort as strings
+		if url.LastMod > latest {
+			latest = url.LastMod
+		}
+	}
+	return latest
+}
+
+// sitemapOverhead is the size of the XML header and the urlset element of a sitemap.
+var sitemapOverhead = len(xml.Header) + len(`<urlset xmlns="`+sitemapNamespace+`"></urlset>`) + 2
+
+// sitemapEntrySize returns the size of an URL in a sitemap.
+func sitemapEntrySize(entry sitemapURL) int {
+	b, _ := xml.MarshalIndent(entry, "  ", "  ")
+	return len(b) + 1
+}
+
+// fitsOneSitemap reports whether all URLs fit in one sitemap.
+func fitsOneSitemap(entries []sitemapURL) bool {
+	if len(entries) > sitemapMaxURLs {
+		return false
+	}
+	size := sitemapOverhead
+	for _, entry := range entries {
+		size += sitemapEntrySize(entry)
+	}
+	return size <= sitemapMaxBytes
+}
+
+// splitSitemaps splits URLs by group, and groups into files within the sitemap limits.
+func splitSitemaps(entries []sitemapURL) []sitemapFile {
+	groups := map[string][]sitemapURL{}
+	for _, entry := range entries {
+		groups[entry.group] = append(groups[entry.group], entry)
+	}
+	names := sitemapGroupNames(sortedKeys(groups))
+
+	var files []sitemapFile
+	for _, group := range sortedKeys(groups) {
+		var (
+			current sitemapFile
+			size    int
+			first   = len(files) // index of the group's first file
+		)
+		for _, entry := range groups[group] {
+			entrySize := sitemapEntrySize(entry)
+			if len(current.urls) == sitemapMaxURLs || (len(current.urls) > 0 && sitemapOverhead+size+entrySize > sitemapMaxBytes) {
+				files = append(files, current)
+				current, size = sitemapFile{}, 0
+			}
+			if len(current.urls) == 0 {
+				current.name = fmt.Sprintf("sitemap-%s-%d.xml", names[group], len(files)-first+1)
+			}
+			current.urls = append(current.urls, entry)
+			size += entrySize
+		}
+		files = append(files, current)
+	}
+	return files
+}
+
+var reSitemapGroup = regexp.MustCompile(`[^a-z0-9]+`)
+
+// sitemapGroupNames returns unique file names of groups: top-level directories in lower case
+// with other characters replaced by "-", or "pages" for the root directory.
+// Names that are taken already get a number, e.g. "pages-2" for a "Pages" directory
+// or "a-b-2" for "A.B" next to "A-B".
+func sitemapGroupNames(groups []string) map[string]string {
+	names := map[string]string{}
+	taken := map[string]bool{}
+	for _, group := range groups {
+		base := strings.Trim(reSitemapGroup.ReplaceAllString(strings.ToLower(group), "-"), "-")
+		if base == "" {
+			base = "pages"
+		}
+		name := base
+		for n := 2; taken[name]; n++ {
+			name = fmt.Sprintf("%s-%d", base, n)
+		}
+		taken[name] = true
+		names[group] = name
+	}
+	return names
+}
+
+// sitemapGroup returns the group of a path: its top-level directory,
+// or an empty string for the home page and files in the root directory.
+func sitemapGroup(path string, isDir bool) string {
+	root, _, nested := strings.Cut(filepath.ToSlash(path), "/")
+	if !nested && !isDir {
+		return ""
+	}
+	return root
 }
 
 type sitemapPath struct {
@@ -61,7 +276,7 @@ type sitemapPath struct {
 	lastMod time.Time
 }
 
-func sitemapEntries(graph *BuildGraph, infoDir string) []sitemapURL {
+func sitemapEntries(graph *BuildGraph, infoDir string, clock buildClock) []sitemapURL {
 	paths := map[string]sitemapPath{}
 
 	for dir := range graph.DirContents {
@@ -69,7 +284,7 @@ func sitemapEntries(graph *BuildGraph, infoDir string) []sitemapURL {
 	}
 	for id, content := range graph.Contents {
 		lastMod, _ := fileModTime(infoDir, content.Source)
-		paths[id] = sitemapPath{lastMod: lastMod}
+		paths[id] = sitemapPath{lastMod: clock.ModTime(lastMod)}
 	}
 	for _, missingPage := range graph.MissingPages {
 		source := ""
@@ -77,7 +292,7 @@ func sitemapEntries(graph *BuildGraph, infoDir string) []sitemapURL {
 			source = missingPage.Content.Source
 		}
 		lastMod, _ := fileModTime(infoDir, source)
-		paths[missingPage.ID] = sitemapPath{lastMod: lastMod}
+		paths[missingPage.ID] = sitemapPath{lastMod: clock.ModTime(lastMod)}
 	}
 
 	addDirectoryLastMod(paths)
@@ -91,7 +306,8 @@ func sitemapEntries(graph *BuildGraph, infoDir string) []sitemapURL {
 	entries := make([]sitemapURL, 0, len(keys))
 	for _, path := range keys {
 		entry := sitemapURL{
-			Loc: sitemapURLForPath(graph.Config.URL, path, paths[path].isDir),
+			Loc:   sitemapURLForPath(graph.Config.URL, path, paths[path].isDir),
+			group: sitemapGroup(path, paths[path].isDir),
 		}
 		if !paths[path].lastMod.IsZero() {
 			entry.LastMod = paths[path].lastMod.UTC().Format(time.RFC3339)
@@ -161,7 +377,7 @@ func sitemapURLForPath(baseURL, path string, isDir bool) string {
 
 func newSitemapURLSet(urls []sitemapURL) sitemapURLSet {
 	return sitemapURLSet{
-		XMLNS: "http://www.sitemaps.org/schemas/sitemap/0.9",
+		XMLNS: sitemapNamespace,
 		URLs:  urls,
 	}
 }
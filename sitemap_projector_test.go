@@ -1,7 +1,10 @@
 package main
 
 import (
+	"compress/gzip"
 	"encoding/xml"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"reflect"
@@ -48,24 +51,44 @@ func TestSitemapProjectorWritesCanonicalURLsAndLastModifiedDates(t *testing.T) {
 		t.Fatalf("Run() error = %v", err)
 	}
 
-	data, err := os.ReadFile(filepath.Join(outputDir, "sitemap.xml"))
+	data, err := os.ReadFile(filepath.Join(outputDir, "sitemap_index.xml"))
 	if err != nil {
 		t.Fatalf("ReadFile() error = %v", err)
 	}
 
 	if !strings.HasPrefix(string(data), xml.Header) {
-		t.Fatalf("sitemap does not start with XML header: %q", string(data))
+		t.Fatalf("sitemap index does not start with XML header: %q", string(data))
 	}
 	if !strings.Contains(string(data), `xmlns="http://www.sitemaps.org/schemas/sitemap/0.9"`) {
-		t.Fatalf("sitemap does not include sitemap namespace: %q", string(data))
+		t.Fatalf("sitemap index does not include sitemap namespace: %q", string(data))
 	}
-
-	var got sitemapURLSet
-	if err := xml.Unmarshal(data, &got); err != nil {
+	var index sitemapIndex
+	if err := xml.Unmarshal(data, &index); err != nil {
 		t.Fatalf("Unmarshal() error = %v", err)
 	}
 
-	entries := append([]sitemapURL{}, got.URLs...)
+	wantIndex := []sitemapIndexEntry{
+		{Loc: "https://alsosee.example/sitemap-pages-1.xml", LastMod: "2026-07-21T13:15:00Z"},
+		{Loc: "https://alsosee.example/sitemap-movies-1.xml", LastMod: "2026-07-20T14:30:00Z"},
+		{Loc: "https://alsosee.example/sitemap-people-1.xml", LastMod: "2026-07-21T13:15:00Z"},
+		{Loc: "https://alsosee.example/sitemap-shows-1.xml"},
+	}
+	if !reflect.DeepEqual(index.Sitemaps, wantIndex) {
+		t.Fatalf("sitemap index = %#v, want %#v", index.Sitemaps, wantIndex)
+	}
+
+	var entries []sitemapURL
+	for _, sitemap := range index.Sitemaps {
+		data, err := os.ReadFile(filepath.Join(outputDir, strings.TrimPrefix(sitemap.Loc, "https://alsosee.example/")))
+		if err != nil {
+			t.Fatalf("ReadFile() error = %v", err)
+		}
+		var got sitemapURLSet
+		if err := xml.Unmarshal(data, &got); err != nil {
+			t.Fatalf("Unmarshal() error = %v", err)
+		}
+		entries = append(entries, got.URLs...)
+	}
 
 	want := []sitemapURL{
 		{
@@ -95,6 +118,122 @@ func TestSitemapProjectorWritesCanonicalURLsAndLastModifiedDates(t *testing.T) {
 	if !reflect.DeepEqual(entries, want) {
 		t.Fatalf("sitemap entries = %#v, want %#v", entries, want)
 	}
+
+	// sitemap.xml lists all URLs while they fit in one sitemap
+	data, err = os.ReadFile(filepath.Join(outputDir, "sitemap.xml"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	var legacy sitemapURLSet
+	if err := xml.Unmarshal(data, &legacy); err != nil {
+		t.Fatalf("Unmarshal(sitemap.xml) error = %v", err)
+	}
+	if !reflect.DeepEqual(legacy.URLs, want) {
+		t.Fatalf("sitemap.xml entries = %#v, want %#v", legacy.URLs, want)
+	}
+}
+
+func TestSitemapProjectorWritesGzipVariants(t *testing.T) {
+	outputDir := t.TempDir()
+	graph := &BuildGraph{
+		Config:      structs.Config{URL: "https://alsosee.example"},
+		DirContents: map[string][]structs.File{"": {}},
+	}
+
+	if err := (SitemapProjector{outputDir: outputDir, gzip: true}).Run(graph); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	index, err := os.ReadFile(filepath.Join(outputDir, "sitemap_index.xml"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	if !strings.Contains(string(index), "<loc>https://alsosee.example/sitemap-pages-1.xml.gz</loc>") {
+		t.Fatalf("sitemap index = %q, want .xml.gz sitemap", index)
+	}
+
+	plain, err := os.ReadFile(filepath.Join(outputDir, "sitemap-pages-1.xml"))
+	if err != nil {
+		t.Fatalf("ReadFile() error = %v", err)
+	}
+	f, err := os.Open(filepath.Join(outputDir, "sitemap-pages-1.xml.gz"))
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	defer f.Close()
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatalf("gzip.NewReader() error = %v", err)
+	}
+	decompressed, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if string(decompressed) != string(plain) {
+		t.Fatalf("decompressed sitemap = %q, want %q", decompressed, plain)
+	}
+	if !r.ModTime.IsZero() || r.Name != "" {
+		t.Fatalf("gzip header = %+v, want no name and modification time", r.Header)
+	}
+}
+
+func TestSplitSitemapsChunksGroups(t *testing.T) {
+	var entries []sitemapURL
+	for i := 0; i < sitemapMaxURLs+1; i++ {
+		entries = append(entries, sitemapURL{Loc: fmt.Sprintf("https://alsosee.example/Movies/%d", i), group: "Movies"})
+	}
+	entries = append(entries, sitemapURL{Loc: "https://alsosee.example/", group: ""})
+
+	if fitsOneSitemap(entries) {
+		t.Fatalf("fitsOneSitemap() = true for %d URLs", len(entries))
+	}
+
+	var got []string
+	for _, file := range splitSitemaps(entries) {
+		got = append(got, fmt.Sprintf("%s:%d", file.name, len(file.urls)))
+	}
+	want := []string{
+		"sitemap-pages-1.xml:1",
+		fmt.Sprintf("sitemap-movies-1.xml:%d", sitemapMaxURLs),
+		"sitemap-movies-2.xml:1",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("splitSitemaps() = %v, want %v", got, want)
+	}
+}
+
+func TestSitemapGroup(t *testing.T) {
+	tests := []struct {
+		path  string
+		isDir bool
+		want  string
+	}{
+		{"", true, ""},
+		{"About", false, ""},
+		{"Movies", true, "Movies"},
+		{"Movies/2024/Dune", false, "Movies"},
+		{"Video Games/Portal", false, "Video Games"},
+	}
+	for _, tt := range tests {
+		if got := sitemapGroup(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("sitemapGroup(%q, %v) = %q, want %q", tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestSitemapGroupNamesAreUnique(t *testing.T) {
+	got := sitemapGroupNames([]string{"", "A-B", "A.B", "Pages", "Video Games", "pages!"})
+	want := map[string]string{
+		"":            "pages",
+		"A-B":         "a-b",
+		"A.B":         "a-b-2",
+		"Pages":       "pages-2",
+		"Video Games": "video-games",
+		"pages!":      "pages-3",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("sitemapGroupNames() = %v, want %v", got, want)
+	}
 }
 
 func TestSitemapProjectorRequiresSiteURL(t *testing.T) {
@@ -0,0 +1,217 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/alsosee/finder/structs"
+)
+
+// Static search index format, version 1 (see README, "Static search").
+// All files are in the search/ directory of the output:
+//
+//	index.json           {"version": 1, "documents": N, "chunk_size": 500, "shards": ["0061", "0068", ...]}
+//	documents/<n>.json   documents n*chunk_size to (n+1)*chunk_size-1, as an array
+//	terms/<shard>.json   {"term": [document numbers], ...} for terms starting with the shard's rune
+//
+// Terms are lowercased words of the document fields with diacritics removed.
+// A shard name is the hexadecimal code point of the first rune of its terms, zero-padded to 4 digits.
+const (
+	staticSearchVersion   = 1
+	staticSearchChunkSize = 500
+)
+
+// StaticSearchProjector writes a search index that the front end queries without a search server.
+type StaticSearchProjector struct {
+	outputDir string
+	out       *outputWriter
+}
+
+type staticSearchMeta struct {
+	Version   int      `json:"version"`
+	Documents int      `json:"documents"`
+	ChunkSize int      `json:"chunk_size"`
+	Shards    []string `json:"shards"`
+}
+
+// staticSearchDocument is a search hit, with field names of structs.Content,
+// so that the front end shows it the same way as a Meilisearch hit.
+type staticSearchDocument struct {
+	Source   string         `json:"Source"`
+	Name     string         `json:"name,omitempty"`
+	Title    string         `json:"title,omitempty"`
+	Subtitle string         `json:"subtitle,omitempty"`
+	Aliases  []string       `json:"aliases,omitempty"`
+	Type     string         `json:"type,omitempty"`
+	Year     int            `json:"year,omitempty"`
+	Released string         `json:"released,omitempty"`
+	DOB      string         `json:"dob,omitempty"`
+	DOD      string         `json:"dod,omitempty"`
+	Image    *structs.Media `json:"image,omitempty"`
+}
+
+func (p StaticSearchProjector) Name() string {
+	return "static-search"
+}
+
+func (p StaticSearchProjector) Outputs() []OutputFile {
+	if p.out == nil {
+		return nil
+	}
+	return p.out.Outputs()
+}
+
+func (p StaticSearchProjector) Run(graph *BuildGraph) error {
+	if p.out == nil {
+		p.out = newOutputWriter()
+	}
+	dir := filepath.Join(p.outputDir, "search")
+
+	var (
+		documents []staticSearchDocument
+		sources   []string
+	)
+	shards := map[string]map[string][]int{}
+	add := func(document staticSearchDocument, source string) {
+		n := len(documents)
+		documents = append(documents, document)
+		sources = append(sources, source)
+
+		for _, term := range staticSearchTerms(document) {
+			shard := staticSearchShard(term)
+			if shards[shard] == nil {
+				shards[shard] = map[string][]int{}
+			}
+			shards[shard][term] = append(shards[shard][term], n)
+		}
+	}
+
+	for _, path := range sortedKeys(graph.Hashes) {
+		if content, ok := graph.Document(path); ok {
+			add(newStaticSearchDocument(content), content.Source)
+		}
+	}
+	// directories, as in the search index (see searchDirectoryDocument)
+	for _, dir := range sortedKeys(graph.DirContents) {
+		if dir == "" {
+			continue // the home page
+		}
+		add(staticSearchDocument{
+			Source: dir + "/",
+			Name:   filepath.Base(dir),
+			Type:   "directory",
+			Image:  searchDirectoryImage(graph.DirContents[dir]),
+		}, "")
+	}
+
+	for start := 0; start < len(documents); start += staticSearchChunkSize {
+		end := min(start+staticSearchChunkSize, len(documents))
+		path := filepath.Join(dir, "documents", strconv.Itoa(start/staticSearchChunkSize)+".json")
+		if err := p.writeJSON(path, documents[start:end], sources[start:end]...); err != nil {
+			return err
+		}
+	}
+
+	for shard, terms := range shards {
+		if err := p.writeJSON(filepath.Join(dir, "terms", shard+".json"), terms); err != nil {
+			return err
+		}
+	}
+
+	return p.writeJSON(filepath.Join(dir, "index.json"), staticSearchMeta{
+		Version:   staticSearchVersion,
+		Documents: len(documents),
+		ChunkSize: staticSearchChunkSize,
+		Shards:    sortedKeys(shards),
+	})
+}
+
+func (p StaticSearchProjector) writeJSON(path string, v any, sources ...string) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshaling %q: %w", path, err)
+	}
+	if _, err := p.out.WriteFile(path, b, sources...); err != nil {
+		return fmt.Errorf("writing static search index: %w", err)
+	}
+	return nil
+}
+
+func newStaticSearchDocument(content *structs.Content) staticSearchDocument {
+	return staticSearchDocument{
+		Source:   content.Source,
+		Name:     content.Name,
+		Title:    content.Title,
+		Subtitle: content.Subtitle,
+		Aliases:  content.Aliases,
+		Type:     content.Type(),
+		Year:     contentYear(content),
+		Released: content.Released,
+		DOB:      content.DOB,
+		DOD:      content.DOD,
+		Image:    content.Image,
+	}
+}
+
+var reYear = regexp.MustCompile(`\b\d{4}\b`)
+
+// contentYear returns the year a content was released, founded or born in, or 0.
+func contentYear(content *structs.Content) int {
+	for _, date := range []string{content.Released, content.Founded, content.DOB} {
+		if year, err := strconv.Atoi(reYear.FindString(date)); err == nil {
+			return year
+		}
+	}
+	return 0
+}
+
+// staticSearchTerms returns unique terms of the document.
+func staticSearchTerms(document staticSearchDocument) []string {
+	fields := []string{document.Name, document.Title, document.Subtitle, document.Type}
+	fields = append(fields, document.Aliases...)
+	if document.Year != 0 {
+		fields = append(fields, strconv.Itoa(document.Year))
+	}
+
+	seen := map[string]bool{}
+	var terms []string
+	for _, field := range fields {
+		for _, term := range tokenize(field) {
+			if !seen[term] {
+				seen[term] = true
+				terms = append(terms, term)
+			}
+		}
+	}
+	return terms
+}
+
+// tokenize splits text into lowercased words without diacritics, e.g. "Amélie Poulain" into ["amelie", "poulain"].
+// The front end tokenizes queries the same way.
+func tokenize(text string) []string {
+	var b strings.Builder
+	for _, r := range norm.NFD.String(text) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		b.WriteRune(unicode.ToLower(r))
+	}
+
+	return strings.FieldsFunc(b.String(), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+}
+
+func staticSearchShard(term string) string {
+	for _, r := range term {
+		return fmt.Sprintf("%04x", r)
+	}
+	return ""
+}
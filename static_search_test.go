@@ -0,0 +1,122 @@
+package main
+
+import (
+	"encoding/json"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/alsosee/finder/structs"
+)
+
+func TestStaticSearchProjectorWritesShardedIndex(t *testing.T) {
+	outputDir := t.TempDir()
+	graph := &BuildGraph{
+		Contents: structs.Contents{
+			"Movies/Amelie":        {Source: "Movies/Amelie.yml", Name: "Amélie", Released: "2001-04-25"},
+			"People/Audrey Tautou": {Source: "People/Audrey Tautou.yml", Name: "Audrey Tautou", Aliases: []string{"Одри Тоту"}},
+		},
+		Media: MediaCatalog{
+			"People": {{Path: "Audrey Tautou.jpg", ThumbPath: "_thumbs.jpg", ThumbWidth: 10, ThumbHeight: 15}},
+		},
+		Hashes: map[string]string{
+			"Movies/Amelie.yml":        "a",
+			"People/Audrey Tautou.yml": "b",
+		},
+	}
+
+	projector := StaticSearchProjector{outputDir: outputDir, out: newOutputWriter()}
+	if err := projector.Run(graph); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var meta staticSearchMeta
+	mustUnmarshalFile(t, filepath.Join(outputDir, "search", "index.json"), &meta)
+	want := staticSearchMeta{Version: 1, Documents: 2, ChunkSize: staticSearchChunkSize, Shards: []string{"0032", "0061", "006d", "0070", "0074", "043e", "0442"}}
+	if !reflect.DeepEqual(meta, want) {
+		t.Fatalf("index.json = %+v, want %+v", meta, want)
+	}
+
+	var documents []staticSearchDocument
+	mustUnmarshalFile(t, filepath.Join(outputDir, "search", "documents", "0.json"), &documents)
+	if len(documents) != 2 || documents[0].Year != 2001 || documents[0].Type != "movie" || documents[1].Image == nil {
+		t.Fatalf("documents = %+v", documents)
+	}
+
+	var terms map[string][]int
+	mustUnmarshalFile(t, filepath.Join(outputDir, "search", "terms", "0061.json"), &terms)
+	if want := map[string][]int{"amelie": {0}, "audrey": {1}}; !reflect.DeepEqual(terms, want) {
+		t.Fatalf("terms starting with a = %v, want %v", terms, want)
+	}
+
+	var aliasTerms map[string][]int
+	mustUnmarshalFile(t, filepath.Join(outputDir, "search", "terms", "043e.json"), &aliasTerms)
+	if want := map[string][]int{"одри": {1}}; !reflect.DeepEqual(aliasTerms, want) {
+		t.Fatalf("terms starting with о = %v, want %v", aliasTerms, want)
+	}
+
+	sources := map[string][]string{}
+	for _, output := range projector.Outputs() {
+		sources[filepath.ToSlash(output.Path)] = output.Sources
+	}
+	if got := sources[filepath.ToSlash(filepath.Join(outputDir, "search", "documents", "0.json"))]; len(got) != 2 {
+		t.Fatalf("documents sources = %v, want both contents", got)
+	}
+}
+
+func TestStaticSearchProjectorIndexesDirectories(t *testing.T) {
+	outputDir := t.TempDir()
+	poster := &structs.Media{Path: "Amelie.jpg"}
+	graph := &BuildGraph{
+		Contents: structs.Contents{},
+		Hashes:   map[string]string{},
+		DirContents: map[string][]structs.File{
+			"":                    {{Name: "Movies", IsFolder: true}},
+			"Movies":              {{Name: "French Films", IsFolder: true}},
+			"Movies/French Films": {{Name: "Amelie", Image: poster}},
+		},
+	}
+
+	projector := StaticSearchProjector{outputDir: outputDir, out: newOutputWriter()}
+	if err := projector.Run(graph); err != nil {
+		t.Fatalf("Run() error = %v", err)
+	}
+
+	var documents []staticSearchDocument
+	mustUnmarshalFile(t, filepath.Join(outputDir, "search", "documents", "0.json"), &documents)
+	want := []staticSearchDocument{
+		{Source: "Movies/", Name: "Movies", Type: "directory"},
+		{Source: "Movies/French Films/", Name: "French Films", Type: "directory", Image: poster},
+	}
+	if !reflect.DeepEqual(documents, want) {
+		t.Fatalf("documents = %+v, want %+v", documents, want)
+	}
+
+	var terms map[string][]int
+	mustUnmarshalFile(t, filepath.Join(outputDir, "search", "terms", "0066.json"), &terms)
+	if !reflect.DeepEqual(terms["french"], []int{1}) {
+		t.Fatalf("terms = %v, want french in the second document", terms)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := map[string][]string{
+		"Amélie Poulain":        {"amelie", "poulain"},
+		"Ёжик в тумане (1975)":  {"ежик", "в", "тумане", "1975"},
+		"Spider-Man: No Way...": {"spider", "man", "no", "way"},
+		"":                      {},
+	}
+	for text, want := range tests {
+		if got := tokenize(text); !reflect.DeepEqual(got, want) {
+			t.Errorf("tokenize(%q) = %q, want %q", text, got, want)
+		}
+	}
+}
+
+func mustUnmarshalFile(t *testing.T, path string, v any) {
+	t.Helper()
+
+	if err := json.Unmarshal([]byte(mustReadFile(t, path)), v); err != nil {
+		t.Fatalf("unmarshaling %q: %v", path, err)
+	}
+}
@@ -18,6 +18,12 @@ type Config struct {
 		Width        int    `yaml:"width"`
 		Height       int    `yaml:"height"`
 		TwitterImage string `yaml:"twitter_image"`
+
+		// Logo is a path to a PNG image in the static directory drawn on generated images, "logo.png" by default.
+		Logo string `yaml:"logo"`
+		// Layouts of generated images by root type directory (e.g. "Movies"),
+		// "default" is used for types without a layout of their own.
+		Layouts map[string]OpenGraphLayout `yaml:"layouts"`
 	} `yaml:"opengraph"`
 	LogoShiftY  string `yaml:"logo_shift_y"`
 	HomeLabel   string `yaml:"home_label"`
@@ -44,4 +50,57 @@ type Config struct {
 	ColumnKind     string `yaml:"column_kind"`
 	OfLabel        string `yaml:"of_label"`
 	AndLabel       string `yaml:"and_label"`
+
+	SearchSettings SearchSettings `yaml:"search_settings"`
+	// SearchDocuments define search documents by root type directory (e.g. "Movies"),
+	// "default" is used for types without a definition of their own.
+	SearchDocuments map[string]SearchDocument `yaml:"search_documents"`
+}
+
+// OpenGraphLayout defines how generated OpenGraph images of a type look.
+type OpenGraphLayout struct {
+	Background string `yaml:"background" json:"background,omitempty"` // e.g. "#faf9f6"
+	Accent     string `yaml:"accent" json:"accent,omitempty"`
+	Text       string `yaml:"text" json:"text,omitempty"`
+
+	// Fields shown under the title instead of the subtitle, e.g. ["released", "directors"].
+	// Two fields joined with "-" are shown as a range, e.g. "dob-dod" for people.
+	// "subtitle" is the content's subtitle.
+	Fields []string `yaml:"fields" json:"fields,omitempty"`
+
+	// Logo is a corner to draw the logo in: "top-left", "top-right", "bottom-left" or "bottom-right".
+	// No logo is drawn if empty.
+	Logo string `yaml:"logo" json:"logo,omitempty"`
+}
+
+// SearchSettings are settings of the search index, applied by the search projector.
+// Settings that are not set are left as they are on the search instance.
+type SearchSettings struct {
+	SearchableAttributes []string             `yaml:"searchable_attributes"` // in order of importance
+	FilterableAttributes []string             `yaml:"filterable_attributes"`
+	SortableAttributes   []string             `yaml:"sortable_attributes"`
+	DisplayedAttributes  []string             `yaml:"displayed_attributes"`
+	RankingRules         []string             `yaml:"ranking_rules"`
+	StopWords            []string             `yaml:"stop_words"`
+	TypoTolerance        *SearchTypoTolerance `yaml:"typo_tolerance"`
+
+	// Synonyms are words and phrases found by each other, e.g. {"nyc": ["new york"]}.
+	// Names and aliases of contents are added to them.
+	Synonyms map[string][]string `yaml:"synonyms"`
+}
+
+// SearchDocument defines what a search document of a type contains
+// in addition to the fields shown in search results.
+type SearchDocument struct {
+	Fields []string `yaml:"fields"` // content fields by their YAML name, e.g. ["description", "genres"]
+	People *bool    `yaml:"people"` // names of connected people, e.g. directors and cast; true by default
+}
+
+// SearchTypoTolerance configures how many typos are allowed in search queries.
+type SearchTypoTolerance struct {
+	Enabled             *bool    `yaml:"enabled"`
+	OneTypo             int64    `yaml:"one_typo"`  // minimal word length to allow one typo
+	TwoTypos            int64    `yaml:"two_typos"` // minimal word length to allow two typos
+	DisableOnWords      []string `yaml:"disable_on_words"`
+	DisableOnAttributes []string `yaml:"disable_on_attributes"`
 }
@@ -286,6 +286,9 @@ type Content struct {
 	References        References    `yaml:"references,omitempty" json:"references,omitempty"`
 	Episodes          []*Episode    `yaml:"episodes,omitempty" json:"episodes,omitempty"`
 
+	// other names, e.g. original titles, transliterations and stage names; used by search
+	Aliases oneOrMany `yaml:"aliases,omitempty" json:"aliases,omitempty"`
+
 	// unknown fields are stored in the Extra map
 	Extra map[string]interface{} `yaml:",inline" json:",omitempty"`
 
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/alsosee/finder/structs"
+)
+
+// Template functions that let .gomd pages enumerate and filter the graph.
+// Functions taking a list accept it as the last argument,
+// so they can be chained in a pipeline:
+//
+//	{{ range query "type:movie has:based_on" | sortBy "-released" | limit 10 }}
+
+// queryEvaluator returns a query evaluator for the current graph,
+// creating it on first use.
+func (g *HTMLProjector) queryEvaluator() *queryEvaluator {
+	g.queryMu.Lock()
+	defer g.queryMu.Unlock()
+
+	if g.evaluator == nil || g.evaluator.graph != g.graph {
+		g.evaluator = newQueryEvaluator(g.graph)
+	}
+	return g.evaluator
+}
+
+// queryContents returns contents matching a filter (see "finder query --help" for the syntax),
+// sorted by path.
+func (g *HTMLProjector) queryContents(filter string) ([]structs.Content, error) {
+	if g.graph == nil {
+		return nil, nil
+	}
+
+	query, err := parseQuery(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	return g.contentsForIDs(g.queryEvaluator().Select(query, "path", 0)), nil
+}
+
+// contentsOfType returns contents of a given type (e.g. "movie" or "person"), sorted by path.
+func (g *HTMLProjector) contentsOfType(contentType string) []structs.Content {
+	if g.graph == nil {
+		return nil
+	}
+
+	return g.contentsForIDs(g.queryEvaluator().Select(graphQuery{
+		{key: "type", op: ":", value: contentType},
+	}, "path", 0))
+}
+
+// contentsIn returns contents in a directory and its subdirectories, sorted by path.
+func (g *HTMLProjector) contentsIn(dir string) []structs.Content {
+	if g.graph == nil {
+		return nil
+	}
+	if dir == "" {
+		return g.contentsForIDs(g.queryEvaluator().Select(nil, "path", 0))
+	}
+
+	return g.contentsForIDs(g.queryEvaluator().Select(graphQuery{
+		{key: "path", op: ":", value: dir},
+	}, "path", 0))
+}
+
+// where returns contents whose field equals value (case-insensitive, any item of a list).
+func (g *HTMLProjector) where(field, value string, list []structs.Content) []structs.Content {
+	if g.graph == nil {
+		return nil
+	}
+
+	term := queryTerm{key: strings.ToLower(field), op: ":", value: value}
+	result := []structs.Content{}
+	for _, content := range list {
+		if g.queryEvaluator().matchTerm(contentID(content), term) {
+			result = append(result, content)
+		}
+	}
+	return result
+}
+
+// sortBy returns contents sorted by a field, in descending order if the field is prefixed with "-".
+func (g *HTMLProjector) sortBy(field string, list []structs.Content) []structs.Content {
+	if g.graph == nil {
+		return list
+	}
+
+	ids := make([]string, 0, len(list))
+	byID := make(map[string]structs.Content, len(list))
+	for _, content := range list {
+		id := contentID(content)
+		ids = append(ids, id)
+		byID[id] = content
+	}
+
+	g.queryEvaluator().Sort(ids, field)
+
+	result := make([]structs.Content, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, byID[id])
+	}
+	return result
+}
+
+// limit returns at most n first contents of the list.
+func limit(n int, list []structs.Content) []structs.Content {
+	if n >= 0 && len(list) > n {
+		return list[:n]
+	}
+	return list
+}
+
+// connectedFrom returns sorted paths of pages that reference the given path,
+// optionally only with one of the given connection labels (e.g. "Director").
+func (g *HTMLProjector) connectedFrom(path string, labels ...string) []string {
+	if g.graph == nil {
+		return nil
+	}
+
+	result := []string{}
+	for from, conns := range g.graph.Connections[path] {
+		if hasConnectionLabel(conns, labels) {
+			result = append(result, from)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// connectionsCount returns a number of pages that reference the given path,
+// optionally only with one of the given connection labels.
+func (g *HTMLProjector) connectionsCount(path string, labels ...string) int {
+	return len(g.connectedFrom(path, labels...))
+}
+
+// sortByConnections returns contents sorted by the number of pages referencing them
+// with the given connection label (empty label counts all connections), most referenced first.
+func (g *HTMLProjector) sortByConnections(label string, list []structs.Content) []structs.Content {
+	var labels []string
+	if label != "" {
+		labels = []string{label}
+	}
+
+	counts := make(map[string]int, len(list))
+	for _, content := range list {
+		id := contentID(content)
+		counts[id] = g.connectionsCount(id, labels...)
+	}
+
+	result := append([]structs.Content{}, list...)
+	sort.SliceStable(result, func(i, j int) bool {
+		a, b := contentID(result[i]), contentID(result[j])
+		if counts[a] != counts[b] {
+			return counts[a] > counts[b]
+		}
+		return a < b
+	})
+	return result
+}
+
+// chain returns paths of all pages in the "previous" chain the given page belongs to,
+// from the first to the last one.
+func (g *HTMLProjector) chain(id string) []string {
+	if g.graph == nil {
+		return nil
+	}
+
+	first := id
+	seen := map[string]bool{id: true}
+	for {
+		prev, ok := g.graph.ChainPages[first][false]
+		if !ok || seen[prev] {
+			break
+		}
+		seen[prev] = true
+		first = prev
+	}
+
+	result := []string{first}
+	seen = map[string]bool{first: true}
+	for current := first; ; {
+		next, ok := g.graph.ChainPages[current][true]
+		if !ok || seen[next] {
+			break
+		}
+		seen[next] = true
+		result = append(result, next)
+		current = next
+	}
+
+	return result
+}
+
+func (g *HTMLProjector) contentsForIDs(ids []string) []structs.Content {
+	result := make([]structs.Content, 0, len(ids))
+	for _, id := range ids {
+		if content, ok := g.contents[id]; ok {
+			result = append(result, content)
+			continue
+		}
+		result = append(result, g.graph.Contents[id])
+	}
+	return result
+}
+
+func contentID(content structs.Content) string {
+	if content.SourceNoExtention != "" {
+		return content.SourceNoExtention
+	}
+	return removeFileExtention(content.Source)
+}
+
+func hasConnectionLabel(conns []structs.Connection, labels []string) bool {
+	if len(labels) == 0 {
+		return true
+	}
+	for _, conn := range conns {
+		for _, label := range labels {
+			if strings.EqualFold(conn.Label, label) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -116,3 +116,75 @@ test("sitemap path can return the diagnostic with finder-debug query", async ()
   assert.equal(body.head_found, false);
   assert.equal(body.get_found, false);
 });
+
+test("sitemap diagnostic checks sitemaps listed in the sitemap index", async () => {
+  const worker = await importWorker();
+  const index = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap>
+    <loc>https://example.com/sitemap-movies-1.xml.gz</loc>
+  </sitemap>
+  <sitemap>
+    <loc>https://example.com/sitemap-pages-1.xml.gz</loc>
+  </sitemap>
+</sitemapindex>
+`;
+  const objects = {
+    "sitemap_index.xml": {
+      size: index.length,
+      httpEtag: '"index"',
+      httpMetadata: { contentType: "application/xml; charset=utf-8" },
+      writeHttpMetadata(headers) {
+        headers.set("content-type", this.httpMetadata.contentType);
+      },
+      async arrayBuffer() {
+        return new TextEncoder().encode(index).buffer;
+      },
+      body: null,
+    },
+    "sitemap-movies-1.xml.gz": { size: 42 },
+  };
+  const env = {
+    SITE: {
+      async head(key) {
+        return objects[key] || null;
+      },
+      async get(key) {
+        return objects[key] || null;
+      },
+    },
+  };
+
+  const response = await worker.default.fetch(new Request("https://example.com/sitemap_index.xml?finder-debug"), env);
+  const body = await response.json();
+
+  assert.equal(body.key, "sitemap_index.xml");
+  assert.equal(body.found, true);
+  assert.deepEqual(body.sitemaps, [
+    { key: "sitemap-movies-1.xml.gz", found: true, size: 42 },
+    { key: "sitemap-pages-1.xml.gz", found: false },
+  ]);
+});
+
+test("split sitemap paths return the diagnostic with finder-debug query", async () => {
+  const worker = await importWorker();
+  const requestedKeys = [];
+  const env = {
+    SITE: {
+      async head(key) {
+        requestedKeys.push(key);
+        return null;
+      },
+      async get() {
+        return null;
+      },
+    },
+  };
+
+  const response = await worker.default.fetch(new Request("https://example.com/sitemap-movies-2.xml.gz?finder-debug=1"), env);
+  const body = await response.json();
+
+  assert.equal(body.key, "sitemap-movies-2.xml.gz");
+  assert.equal(body.found, false);
+  assert.deepEqual(requestedKeys, ["sitemap-movies-2.xml.gz"]);
+});
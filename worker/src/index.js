@@ -1,5 +1,5 @@
 import { handleImageProxy } from "./image-proxy.js";
-import { handleSitemapDiagnostic } from "./site-diagnostics.js";
+import { handleSitemapDiagnostic, isSitemapPath } from "./site-diagnostics.js";
 import { handleStaticSite } from "./static-site.js";
 import { handleUpload } from "./upload.js";
 
@@ -19,8 +19,8 @@ export default {
       return handleSitemapDiagnostic(request, env);
     }
 
-    if (url.pathname === "/sitemap.xml" && url.searchParams.has("finder-debug")) {
-      return handleSitemapDiagnostic(request, env);
+    if (isSitemapPath(url.pathname) && url.searchParams.has("finder-debug")) {
+      return handleSitemapDiagnostic(request, env, url.pathname.slice(1));
     }
 
     if (env.SITE) {
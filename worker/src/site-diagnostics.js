@@ -10,7 +10,15 @@ function jsonResponse(body, status = 200) {
   });
 }
 
-export async function handleSitemapDiagnostic(request, env) {
+// sitemap.xml and sitemap_index.xml list split sitemaps, e.g. sitemap-movies-1.xml or sitemap-movies-1.xml.gz
+const SITEMAP_PATH = /^\/(sitemap\.xml|sitemap_index\.xml|sitemap-[a-z0-9-]+\.xml(\.gz)?)$/;
+const SITEMAP_INDEX_KEYS = new Set(["sitemap.xml", "sitemap_index.xml"]);
+
+export function isSitemapPath(pathname) {
+  return SITEMAP_PATH.test(pathname);
+}
+
+export async function handleSitemapDiagnostic(request, env, key = "sitemap.xml") {
   if (request.method !== "GET" && request.method !== "HEAD") {
     return jsonResponse(
       { error: { message: "Method Not Allowed" } },
@@ -21,25 +29,25 @@ export async function handleSitemapDiagnostic(request, env) {
   const bucket = env.SITE;
   if (!bucket) {
     return jsonResponse({
-      key: "sitemap.xml",
-      candidate_keys: candidateKeys("/sitemap.xml"),
+      key,
+      candidate_keys: candidateKeys("/" + key),
       bucket_configured: false,
       found: false,
     });
   }
 
-  const headObject = await bucket.head("sitemap.xml");
-  const getObject = await bucket.get("sitemap.xml");
+  const headObject = await bucket.head(key);
+  const getObject = await bucket.get(key);
   const staticResponse = await handleStaticSite(
-    new Request(new URL("/sitemap.xml", request.url), { method: "GET" }),
+    new Request(new URL("/" + key, request.url), { method: "GET" }),
     env,
   );
   await staticResponse.body?.cancel();
 
   if (!headObject && !getObject) {
     return jsonResponse({
-      key: "sitemap.xml",
-      candidate_keys: candidateKeys("/sitemap.xml"),
+      key,
+      candidate_keys: candidateKeys("/" + key),
       bucket_configured: true,
       found: false,
       head_found: false,
@@ -51,9 +59,10 @@ export async function handleSitemapDiagnostic(request, env) {
   }
 
   const object = getObject || headObject;
+  const sitemaps = SITEMAP_INDEX_KEYS.has(key) ? await indexedSitemaps(bucket, getObject) : undefined;
   return jsonResponse({
-    key: "sitemap.xml",
-    candidate_keys: candidateKeys("/sitemap.xml"),
+    key,
+    candidate_keys: candidateKeys("/" + key),
     bucket_configured: true,
     found: true,
     head_found: Boolean(headObject),
@@ -67,5 +76,37 @@ export async function handleSitemapDiagnostic(request, env) {
     uploaded: object.uploaded?.toISOString(),
     http_metadata: object.httpMetadata,
     custom_metadata: object.customMetadata,
+    sitemaps,
   });
 }
+
+// indexedSitemaps checks that sitemaps listed in a sitemap index are in the bucket.
+async function indexedSitemaps(bucket, object) {
+  if (typeof object?.arrayBuffer !== "function") {
+    return undefined;
+  }
+
+  const text = await objectText(object);
+  if (!text.includes("<sitemapindex")) {
+    return undefined;
+  }
+
+  const sitemaps = [];
+  for (const [, loc] of text.matchAll(/<loc>([^<]+)<\/loc>/g)) {
+    const [key] = candidateKeys(new URL(loc.trim()).pathname);
+    const head = await bucket.head(key);
+    sitemaps.push({ key, found: Boolean(head), size: head?.size });
+  }
+  return sitemaps;
+}
+
+// objectText returns the text of an object, which may be stored gzip-compressed.
+async function objectText(object) {
+  const bytes = new Uint8Array(await object.arrayBuffer());
+  if (bytes.length < 2 || bytes[0] !== 0x1f || bytes[1] !== 0x8b) {
+    return new TextDecoder().decode(bytes);
+  }
+
+  const stream = new Blob([bytes]).stream().pipeThrough(new DecompressionStream("gzip"));
+  return new Response(stream).text();
+}
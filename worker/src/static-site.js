@@ -13,6 +13,7 @@ const TEXT_TYPES = {
 
 const BINARY_TYPES = {
   avif: "image/avif",
+  gz: "application/gzip",
   ico: "image/x-icon",
   jpeg: "image/jpeg",
   jpg: "image/jpeg",